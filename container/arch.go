@@ -0,0 +1,98 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// the names qemu-user uses for the GOARCHes we might be running on and for elf machines, and the arches
+// a host runs natively besides its own, as long as the kernel was built with compat support
+var (
+	goarchArches = map[string]string{
+		"amd64":   "x86_64",
+		"386":     "i386",
+		"arm64":   "aarch64",
+		"arm":     "arm",
+		"riscv64": "riscv64",
+		"ppc64le": "ppc64le",
+		"ppc64":   "ppc64",
+		"s390x":   "s390x",
+	}
+	qemuArches = map[elf.Machine]string{
+		elf.EM_X86_64:  "x86_64",
+		elf.EM_386:     "i386",
+		elf.EM_AARCH64: "aarch64",
+		elf.EM_ARM:     "arm",
+		elf.EM_RISCV:   "riscv64",
+		elf.EM_PPC64:   "ppc64le", // or ppc64 when it's big endian, see elfArch
+		elf.EM_S390:    "s390x",
+	}
+	nativeArches = map[string][]string{
+		"amd64": {"i386"},
+		"arm64": {"arm"},
+	}
+)
+
+// elfArch is the qemu-user name of the arch f is built for
+func elfArch(f *elf.File) (string, bool) {
+	arch, ok := qemuArches[f.Machine]
+	if f.Machine == elf.EM_PPC64 && f.Data == elf.ELFDATA2MSB {
+		arch = "ppc64"
+	}
+	return arch, ok
+}
+
+func runsNatively(arch string) bool {
+	if arch == goarchArches[runtime.GOARCH] {
+		return true
+	}
+	for _, compat := range nativeArches[runtime.GOARCH] {
+		if arch == compat {
+			return true
+		}
+	}
+	return false
+}
+
+// emulator returns the command to prefix cmd with so it can run on this host, nil if it runs natively
+// (or the kernel already hands it to qemu through binfmt_misc), or an error explaining what's missing
+func emulator(cmd string) ([]string, error) {
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := elf.Open(path)
+	if err != nil {
+		// not an elf binary (a script or similar), the kernel will sort it out
+		return nil, nil
+	}
+	arch, ok := elfArch(f)
+	machine := f.Machine
+	f.Close()
+
+	if !ok {
+		return nil, fmt.Errorf("%s is built for %s, which qemu-user can't run here", path, machine)
+	}
+	if runsNatively(arch) {
+		return nil, nil
+	}
+
+	// a registered and enabled binfmt_misc handler means exec just works
+	if b, err := os.ReadFile("/proc/sys/fs/binfmt_misc/qemu-" + arch); err == nil && strings.HasPrefix(string(b), "enabled") {
+		return nil, nil
+	}
+
+	for _, name := range []string{"qemu-" + arch + "-static", "qemu-" + arch} {
+		if qemu, err := exec.LookPath(name); err == nil {
+			return []string{qemu}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is built for %s but this host is %s, install qemu-user-static "+
+		"(and optionally register it with binfmt_misc) to run it", path, arch, runtime.GOARCH)
+}
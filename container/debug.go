@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// debugNamespaces are joined with setns by the thread that starts the command, which it inherits them from.
+// the mount namespace can't be, like for watch it's chrooted into through /proc/<pid>/root instead
+var debugNamespaces = []string{"uts", "ipc", "net"}
+
+// setns by GOARCH, which package syscall doesn't have
+var setnsSyscalls = map[string]uintptr{
+	"amd64": 308, "386": 346, "arm64": 268, "arm": 375, "riscv64": 268, "ppc64le": 350, "s390x": 339,
+}
+
+// debug implements `debug <pid> [cmd] [args...]`: it runs cmd, a shell by default, inside the container of pid,
+// with its hostname, ipc and network, and its filesystem as it sees it, like nsenter
+func debug() {
+	if len(os.Args) < 3 {
+		fmt.Printf("usage: %s debug <pid> [cmd] [args...]\n", os.Args[0])
+		os.Exit(2)
+	}
+	pid, err := strconv.Atoi(os.Args[2])
+	if err != nil || pid <= 0 {
+		fmt.Printf("bad pid %q\n", os.Args[2])
+		os.Exit(2)
+	}
+	root := fmt.Sprintf("/proc/%d/root", pid)
+	args := os.Args[3:]
+	if len(args) == 0 {
+		args = []string{"sh"}
+	}
+	path, err := lookPathIn(root, args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// the thread stays in the container's namespaces, it's never unlocked so it goes away with us
+	runtime.LockOSThread()
+	for _, ns := range debugNamespaces {
+		if err := setns(pid, ns); err != nil {
+			fmt.Printf("joining the %s namespace of %d: %v\n", ns, pid, err)
+			os.Exit(1)
+		}
+	}
+
+	cmd := &exec.Cmd{Path: path, Args: args, Dir: "/"}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Chroot: root}
+
+	fmt.Printf("Debugging %d with %v\n", pid, args)
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.ExitCode())
+		}
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func setns(pid int, ns string) error {
+	nr, ok := setnsSyscalls[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("no setns on %s", runtime.GOARCH)
+	}
+	f, err := os.Open(fmt.Sprintf("/proc/%d/ns/%s", pid, ns))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := syscall.RawSyscall(nr, f.Fd(), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// lookPathIn finds cmd like a shell would inside root, the path it returns is the one inside it
+func lookPathIn(root, cmd string) (string, error) {
+	if strings.Contains(cmd, "/") {
+		if _, err := os.Stat(filepath.Join(root, cmd)); err != nil {
+			return "", err
+		}
+		return filepath.Join("/", cmd), nil
+	}
+	for _, dir := range []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"} {
+		if fi, err := os.Stat(filepath.Join(root, dir, cmd)); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			return filepath.Join(dir, cmd), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in the container", cmd)
+}
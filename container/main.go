@@ -1,14 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"syscall"
 )
 
-// docker         run image <cmd> <params>
-// go run main.go run       <cmd> <params>
+// docker         run [-v src:dst[:mode]] [--sysctl key=value] image <cmd> <params>
+// go run main.go run [-v src:dst[:mode]] [--sysctl key=value]       <cmd> <params>
+// go run main.go watch <pid> /path                                   # inotify events of a path inside the container of pid
+// go run main.go debug <pid> [cmd] [args...]                       # a shell, or cmd, inside the container of pid
 
 func main() {
 	switch os.Args[1] {
@@ -16,13 +19,49 @@ func main() {
 		run()
 	case "child":
 		child()
+	case "watch":
+		watch()
+	case "debug":
+		debug()
 	default:
 		panic("bad command")
 	}
 }
 
+// options are the flags shared by run and child, the child gets the same arguments and parses them again
+type options struct {
+	mounts  bindMounts
+	sysctls sysctls
+}
+
+// parseArgs parses the flags, returning the command to run
+func parseArgs(name string) (options, []string) {
+	var opts options
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Var(&opts.mounts, "v", "bind mount src:dst[:rshared|rslave|rprivate] into the container, can be repeated. an rshared one propagates both ways, so it also shows up at dst on the host until the container exits")
+	fs.Var(&opts.sysctls, "sysctl", "set a namespaced sysctl key=value inside the container, eg net.ipv4.ip_forward=1, can be repeated")
+	fs.Parse(os.Args[2:])
+	if fs.NArg() == 0 {
+		fmt.Fprintf(fs.Output(), "usage: %s %s [flags] <cmd> [args...]\n", os.Args[0], name)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	return opts, fs.Args()
+}
+
 func run() {
-	fmt.Printf("Running %v\n", os.Args[2:])
+	opts, args := parseArgs("run")
+	fmt.Printf("Running %v\n", args)
+
+	// fail before setting anything up if the command can't run on this host
+	if _, err := emulator(args[0]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := opts.mounts.check(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	cmd := exec.Command("/proc/self/exe", append([]string{"child"}, os.Args[2:]...)...)
 
@@ -31,21 +70,43 @@ func run() {
 	cmd.Stderr = os.Stderr
 
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS, // gives us a separate hostname (original will be inherited, but we can override it without changing the host)
-
+		Cloneflags: syscall.CLONE_NEWUTS | // gives us a separate hostname (original will be inherited, but we can override it without changing the host)
+			syscall.CLONE_NEWNS | // separate mount table, so -v mounts stay in here (unless they're rshared)
+			opts.sysctls.cloneflags(), // net/ipc namespaces, only when -sysctl needs them
 	}
 
-	err := cmd.Run()
+	unmount, err := opts.mounts.hostCopies()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = cmd.Run()
+	unmount()
 	fmt.Println(err)
 
 }
 
 func child() {
-	fmt.Printf("Running clone %v\n", os.Args[2:])
+	opts, args := parseArgs("child")
+	fmt.Printf("Running clone %v\n", args)
 
 	syscall.Sethostname([]byte("test"))
 
-	cmd := exec.Command(os.Args[2], os.Args[3:]...)
+	if err := opts.mounts.setup(); err != nil {
+		panic(err)
+	}
+	if err := opts.sysctls.apply(); err != nil {
+		panic(err)
+	}
+
+	// foreign arch binaries run under qemu-user when binfmt_misc doesn't handle them
+	emu, err := emulator(args[0])
+	if err != nil {
+		panic(err)
+	}
+	argv := append(emu, args...)
+
+	cmd := exec.Command(argv[0], argv[1:]...)
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// bindMount is a -v src:dst[:propagation] flag
+type bindMount struct {
+	src, dst    string
+	propagation string // rprivate, rslave or rshared
+}
+
+var propagationFlags = map[string]uintptr{
+	"rprivate": syscall.MS_PRIVATE,
+	"rslave":   syscall.MS_SLAVE,
+	"rshared":  syscall.MS_SHARED,
+}
+
+// bindMounts collects repeated -v flags
+type bindMounts []bindMount
+
+func (m *bindMounts) String() string {
+	var s []string
+	for _, b := range *m {
+		s = append(s, b.src+":"+b.dst+":"+b.propagation)
+	}
+	return strings.Join(s, ",")
+}
+
+func (m *bindMounts) Set(v string) error {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("bad mount %q, expected src:dst[:rprivate|rslave|rshared]", v)
+	}
+
+	b := bindMount{src: parts[0], dst: parts[1], propagation: "rprivate"}
+	if len(parts) == 3 {
+		if _, ok := propagationFlags[parts[2]]; !ok {
+			return fmt.Errorf("bad mount %q, propagation must be rprivate, rslave or rshared", v)
+		}
+		b.propagation = parts[2]
+	}
+
+	src, err := filepath.Abs(b.src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	b.src = src
+	*m = append(*m, b)
+	return nil
+}
+
+// check fails early if the host side can't give the requested propagation,
+// an rshared mount needs its source on a shared mount, an rslave one on a shared or slave mount
+func (m bindMounts) check() error {
+	for _, b := range m {
+		if b.propagation == "rprivate" {
+			continue
+		}
+		shared, slave, err := mountPropagation(b.src)
+		if err != nil {
+			return err
+		}
+		if !shared && !(slave && b.propagation == "rslave") {
+			return fmt.Errorf("%s is not on a shared mount, so it can't be mounted %s (try `mount --make-rshared /`)", b.src, b.propagation)
+		}
+	}
+	return nil
+}
+
+// setup runs inside the new mount namespace, before the command starts
+func (m bindMounts) setup() error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	// rshared mounts go first, while this namespace's copies of the host mounts are still their peers: a bind
+	// of one joins the source's peer group, so a fuse or nested mount under it in here reaches the host. being
+	// under / it also shows up at dst on the host, which the parent unmounts when we're done, see hostCopies
+	var shared []string
+	for _, b := range m {
+		if b.propagation != "rshared" {
+			continue
+		}
+		if err := b.mount(); err != nil {
+			return err
+		}
+		dst, err := filepath.Abs(b.dst)
+		if err != nil {
+			return err
+		}
+		shared = append(shared, dst)
+	}
+
+	// then nothing else we mount leaks back to the host, while host mounts still show up in here. a recursive
+	// MS_SLAVE on / would take the rshared mounts out of the host's peer group, so it's one mount at a time
+	points, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, point := range points {
+		if withinAny(point, shared) {
+			continue
+		}
+		if err := syscall.Mount("", point, "", syscall.MS_SLAVE, ""); err != nil {
+			return fmt.Errorf("making %s rslave: %w", point, err)
+		}
+	}
+
+	for _, b := range m {
+		if b.propagation == "rshared" {
+			continue
+		}
+		if err := b.mount(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b bindMount) mount() error {
+	if err := os.MkdirAll(b.dst, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount(b.src, b.dst, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("mounting %s on %s: %w", b.src, b.dst, err)
+	}
+	if err := syscall.Mount("", b.dst, "", syscall.MS_REC|propagationFlags[b.propagation], ""); err != nil {
+		return fmt.Errorf("making %s %s: %w", b.dst, b.propagation, err)
+	}
+	return nil
+}
+
+// hostCopies counts the mounts on the dst of every rshared mount, on the host before the container starts.
+// the unmount it returns takes off the ones the container's rshared mounts added there, and with them what
+// the container mounted under them, which also goes from the source. a fuse mount whose daemon went with the
+// container would be dead anyway
+func (m bindMounts) hostCopies() (unmount func(), err error) {
+	before := map[string]int{}
+	for _, b := range m {
+		if b.propagation != "rshared" {
+			continue
+		}
+		dst, err := filepath.Abs(b.dst)
+		if err != nil {
+			return nil, err
+		}
+		if before[dst], err = mountCount(dst); err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		for dst, n := range before {
+			for {
+				now, err := mountCount(dst)
+				if err != nil || now <= n {
+					break
+				}
+				if err := syscall.Unmount(dst, syscall.MNT_DETACH); err != nil {
+					fmt.Printf("unmounting the host copy of %s: %v\n", dst, err)
+					break
+				}
+			}
+		}
+	}, nil
+}
+
+// mountPoints are the mount points in /proc/self/mountinfo, in the order they were mounted
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) >= 5 {
+			points = append(points, unescapeMountPoint(fields[4]))
+		}
+	}
+	return points, s.Err()
+}
+
+// mountCount is how many mounts are stacked on path
+func mountCount(path string) (int, error) {
+	points, err := mountPoints()
+	n := 0
+	for _, point := range points {
+		if point == path {
+			n++
+		}
+	}
+	return n, err
+}
+
+// unescapeMountPoint undoes the octal escapes mountinfo uses for spaces, tabs, newlines and backslashes
+func unescapeMountPoint(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountPropagation looks up the mount path lives on in /proc/self/mountinfo,
+// and whether it's in a peer group and/or receives events from one
+func mountPropagation(path string) (shared, slave bool, err error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false, false, err
+	}
+	defer f.Close()
+
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 shared:2 - ext3 /dev/root rw
+	best := ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		mountpoint := unescapeMountPoint(fields[4])
+		if !within(path, mountpoint) || len(mountpoint) < len(best) {
+			continue
+		}
+		best, shared, slave = mountpoint, false, false
+		for _, opt := range fields[6:] {
+			if opt == "-" {
+				break
+			}
+			shared = shared || strings.HasPrefix(opt, "shared:")
+			slave = slave || strings.HasPrefix(opt, "master:")
+		}
+	}
+	return shared, slave, s.Err()
+}
+
+func within(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+func withinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if within(path, dir) {
+			return true
+		}
+	}
+	return false
+}
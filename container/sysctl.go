@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// sysctls collects repeated -sysctl key=value flags
+type sysctls map[string]string
+
+// namespaced sysctls, and the namespace that has to be unshared so writing them doesn't touch the host.
+// anything else is global to the kernel and refused
+var (
+	ipcSysctls = map[string]bool{
+		"kernel.msgmax": true, "kernel.msgmnb": true, "kernel.msgmni": true, "kernel.sem": true,
+		"kernel.shmall": true, "kernel.shmmax": true, "kernel.shmmni": true, "kernel.shm_rmid_forced": true,
+	}
+	utsSysctls = map[string]bool{
+		"kernel.domainname": true,
+	}
+)
+
+func (s *sysctls) String() string {
+	var kv []string
+	for k, v := range *s {
+		kv = append(kv, k+"="+v)
+	}
+	return strings.Join(kv, ",")
+}
+
+func (s *sysctls) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("bad sysctl %q, expected key=value", v)
+	}
+	if sysctlNamespace(key) == 0 {
+		return fmt.Errorf("sysctl %s isn't namespaced, setting it would change the host", key)
+	}
+	if *s == nil {
+		*s = sysctls{}
+	}
+	(*s)[key] = value
+	return nil
+}
+
+// sysctlNamespace is the clone flag of the namespace key belongs to, 0 if it isn't namespaced
+func sysctlNamespace(key string) uintptr {
+	switch {
+	case strings.HasPrefix(key, "net."):
+		return syscall.CLONE_NEWNET
+	case ipcSysctls[key], strings.HasPrefix(key, "fs.mqueue."):
+		return syscall.CLONE_NEWIPC
+	case utsSysctls[key]:
+		return syscall.CLONE_NEWUTS
+	}
+	return 0
+}
+
+// cloneflags are the namespaces the child needs so the sysctls only apply inside it
+func (s sysctls) cloneflags() uintptr {
+	var flags uintptr
+	for key := range s {
+		flags |= sysctlNamespace(key)
+	}
+	return flags
+}
+
+// apply runs in the child, /proc/sys reflects the namespaces of whoever writes to it
+func (s sysctls) apply() error {
+	for key, value := range s {
+		path := "/proc/sys/" + strings.ReplaceAll(key, ".", "/")
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			return fmt.Errorf("setting sysctl %s: %w", key, err)
+		}
+	}
+	return nil
+}
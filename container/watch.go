@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inotify events by name, in the order they're printed when one event has several
+var inotifyEvents = []struct {
+	mask uint32
+	name string
+}{
+	{syscall.IN_CREATE, "CREATE"}, {syscall.IN_MODIFY, "MODIFY"}, {syscall.IN_ATTRIB, "ATTRIB"},
+	{syscall.IN_CLOSE_WRITE, "CLOSE_WRITE"}, {syscall.IN_MOVED_FROM, "MOVED_FROM"}, {syscall.IN_MOVED_TO, "MOVED_TO"},
+	{syscall.IN_DELETE, "DELETE"}, {syscall.IN_DELETE_SELF, "DELETE_SELF"}, {syscall.IN_MOVE_SELF, "MOVE_SELF"},
+	{syscall.IN_ISDIR, "ISDIR"},
+}
+
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// watch implements `watch <pid> <path>`: it prints the inotify events of path as the container of pid sees it,
+// until that process exits. the path is opened through /proc/<pid>/root, which is the container's root in its
+// own mount namespace, a go program can't setns into one. a file is watched through its directory, so
+// rewriting it by renaming a new one over it shows up too
+func watch() {
+	if len(os.Args) != 4 {
+		fmt.Printf("usage: %s watch <pid> <path>\n", os.Args[0])
+		os.Exit(2)
+	}
+	pid, err := strconv.Atoi(os.Args[2])
+	if err != nil || pid <= 0 {
+		fmt.Printf("bad pid %q\n", os.Args[2])
+		os.Exit(2)
+	}
+	path := filepath.Clean("/" + os.Args[3])
+	hostPath := filepath.Join(fmt.Sprintf("/proc/%d/root", pid), path)
+
+	fi, err := os.Stat(hostPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dir, name := hostPath, "" // name is the only entry of dir that's printed, everything for a directory
+	if !fi.IsDir() {
+		dir, name = filepath.Dir(hostPath), filepath.Base(hostPath)
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, watchMask); err != nil {
+		fmt.Printf("watching %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Watching %s in %d\n", path, pid)
+
+	go func() {
+		for syscall.Kill(pid, 0) != syscall.ESRCH {
+			time.Sleep(time.Second)
+		}
+		fmt.Printf("%d exited\n", pid)
+		os.Exit(0)
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			entry := strings.TrimRight(string(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+int(ev.Len)]), "\x00")
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+			if name != "" && entry != name && ev.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) == 0 {
+				continue
+			}
+			shown := filepath.Join(path, entry)
+			if name != "" {
+				shown = filepath.Join(filepath.Dir(path), entry)
+			}
+			fmt.Printf("%s %s %s\n", time.Now().Format("15:04:05.000"), eventNames(ev.Mask), shown)
+		}
+	}
+}
+
+func eventNames(mask uint32) string {
+	var names []string
+	for _, e := range inotifyEvents {
+		if mask&e.mask != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// the -fixed render path does the per sample work of the oscillators and the mixer in Q15 integers,
+// for GOARCHes without (fast) floating point. the phase of a sample is its position in the period
+// as a 0.32 fixed point fraction, so it wraps around for free
+
+// fixedWaves are the Q15 versions of waves
+var fixedWaves = map[string]func(r *rand.Rand) func(phase uint32) int16{
+	"sine": func(*rand.Rand) func(uint32) int16 {
+		return sineQ15
+	},
+	// white noise, frequency is ignored
+	"noise": func(r *rand.Rand) func(uint32) int16 {
+		return func(uint32) int16 {
+			return int16(r.Uint32() >> 16)
+		}
+	},
+}
+
+// one period of a sine, only computed once so it's fine to use floats
+var sineTable = func() (t [1024]int16) {
+	for i := range t {
+		t[i] = int16(math.Round(math.Sin(2*math.Pi*float64(i)/float64(len(t))) * 32767))
+	}
+	return t
+}()
+
+// sineQ15 interpolates linearly between the two table entries around phase
+func sineQ15(phase uint32) int16 {
+	i := phase >> 22                 // top 10 bits pick the entry
+	frac := int32(phase>>7) & 0x7fff // the next 15 are how far we are towards the next one
+	a, b := int32(sineTable[i]), int32(sineTable[(i+1)%1024])
+	return int16(a + (b-a)*frac>>15)
+}
+
+// mulQ15 multiplies two Q15 numbers
+func mulQ15(a, b int16) int16 {
+	return int16(int32(a) * int32(b) >> 15)
+}
+
+// saturate clips a sum of Q15 samples back into range
+func saturate(v int32) int16 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func NewFixedSound(freq float64, duration time.Duration, function func(uint32) int16) *Sound {
+	s := NewSound(freq, duration, nil)
+	s.fixed = function
+	s.phaseStep = uint32(freq / float64(*sampleRate) * (1 << 32))
+	return s
+}
+
+// fillFixed renders buf from sample p on, the fixed point version of the loops in Read
+func (s *Sound) fillFixed(buf []byte, p int64, level *smoothed) {
+	num := (*bitDepthInBytes) * (*channelCount)
+	for i := 0; i < len(buf)/num; i++ {
+		b := mulQ15(s.fixed(uint32(uint64(p)*uint64(s.phaseStep))), level.nextQ15(*sampleRate))
+		for ch := 0; ch < *channelCount; ch++ {
+			if *bitDepthInBytes == 1 {
+				buf[num*i+ch] = byte(int(b>>8) + 128)
+			} else {
+				buf[num*i+2*ch] = byte(b)
+				buf[num*i+1+2*ch] = byte(b >> 8)
+			}
+		}
+		p++
+	}
+}
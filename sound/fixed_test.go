@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// render reads all of a seeded sine through the float or the -fixed path, with a gain ramp on the way,
+// as 16 bit samples of the first channel
+func render(t *testing.T, fixed bool) []int16 {
+	*fixedPoint = fixed
+	defer func() { *fixedPoint = false }()
+
+	s := newVoice("sine", rand.New(rand.NewSource(1)))(440, 500*time.Millisecond)
+	if err := s.SetParam(gain.name, 0.9, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	num := *bitDepthInBytes * *channelCount
+	samples := make([]int16, 0, len(b)/num)
+	for i := 0; i+1 < len(b); i += num {
+		samples = append(samples, int16(b[i])|int16(b[i+1])<<8)
+	}
+	return samples
+}
+
+func TestFixedMatchesFloat(t *testing.T) {
+	// the sine table's interpolation and the truncating Q15 multiply are off by a few LSB at most
+	const maxLSB = 4
+
+	want, got := render(t, false), render(t, true)
+	if len(got) != len(want) {
+		t.Fatalf("fixed rendered %d samples, float %d", len(got), len(want))
+	}
+	worst, at := 0, 0
+	for i := range want {
+		d := int(got[i]) - int(want[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > worst {
+			worst, at = d, i
+		}
+	}
+	if worst > maxLSB {
+		t.Errorf("fixed is %d LSB off float at sample %d (%d instead of %d), want at most %d", worst, at, got[at], want[at], maxLSB)
+	}
+	t.Logf("worst difference %d LSB", worst)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// frozenSound is a Sound rendered ahead of time into memory and played back from there, so a sound that's too
+// heavy to render live (many voices and effects) costs a copy per buffer. the gain is baked in at the values
+// it had while freezing, live changes only reach it again once it's unfrozen. that happens by itself when the
+// freeze param drops, playback then goes on live from where it got to
+type frozenSound struct {
+	s   *Sound
+	pcm []byte
+	pos int
+}
+
+// Freeze renders s from its start to its end, s isn't read again until it's unfrozen
+func Freeze(s *Sound) (f *frozenSound, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("freezing sound %.1fHz: %v", s.freq, r)
+		}
+	}()
+	s.rewind()
+	pcm := make([]byte, s.length)
+	// one read of the whole sound, its length is what Read works in so nothing is left over
+	if _, err := io.ReadFull(s, pcm); err != nil {
+		return nil, fmt.Errorf("freezing sound %.1fHz: %w", s.freq, err)
+	}
+	return &frozenSound{s: s, pcm: pcm}, nil
+}
+
+// Unfreeze drops the rendered audio, the sound is rendered live again from where the playback got to
+func (f *frozenSound) Unfreeze() *Sound {
+	f.pcm = nil
+	f.s.rewind()
+	f.s.pos = int64(f.pos)
+	return f.s
+}
+
+func (f *frozenSound) Read(buf []byte) (int, error) {
+	if f.pcm != nil && frozen.get() < 0.5 {
+		// the sound can only go on from the start of a frame, the rest of this one still comes from pcm
+		frame := *bitDepthInBytes * *channelCount
+		if left := frame - f.pos%frame; left == frame {
+			f.Unfreeze()
+		} else if len(buf) > left {
+			buf = buf[:left]
+		}
+	}
+	if f.pcm == nil {
+		return f.s.Read(buf)
+	}
+	if f.pos == len(f.pcm) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.pcm[f.pos:])
+	f.pos += n
+	return n, nil
+}
+
+func (s *Sound) rewind() {
+	s.pos = 0
+	s.remaining = nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestUnfreezeGoesOnLive(t *testing.T) {
+	sine := newVoice("sine", rand.New(rand.NewSource(1)))
+	want, err := io.ReadAll(sine(440, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frozen.set(1)
+	defer frozen.set(0)
+	f, err := Freeze(sine(440, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an odd read, so the unfreeze lands in the middle of a frame
+	got := make([]byte, len(want)/2+1)
+	if _, err := io.ReadFull(f, got); err != nil {
+		t.Fatal(err)
+	}
+	frozen.set(0)
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.pcm != nil {
+		t.Error("still frozen after the freeze param dropped")
+	}
+	if got = append(got, rest...); !bytes.Equal(got, want) {
+		t.Errorf("frozen then live playback differs from a live one, %d bytes instead of %d", len(got), len(want))
+	}
+}
@@ -3,6 +3,11 @@ module github.com/hpdobrica/go-playground/sound
 go 1.18
 
 require (
-	github.com/hajimehoshi/oto/v2 v2.2.0 // indirect
-	golang.org/x/sys v0.0.0-20220712014510-0a85c31ab51e // indirect
+	github.com/ebitengine/oto/v3 v3.1.0
+	github.com/hajimehoshi/oto/v2 v2.2.0
+)
+
+require (
+	github.com/ebitengine/purego v0.5.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
 )
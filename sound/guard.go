@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+)
+
+// guardedReader keeps a panic in one sound from killing the audio goroutine that oto reads all players from.
+// the panicking sound is logged and reported as finished, so oto drops its player and the rest keep playing
+type guardedReader struct {
+	name   string
+	r      io.Reader
+	failed bool
+}
+
+func guard(name string, r io.Reader) io.Reader {
+	return &guardedReader{name: name, r: r}
+}
+
+func (g *guardedReader) Read(buf []byte) (n int, err error) {
+	if g.failed {
+		return 0, io.EOF
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "%s panicked, removing it: %v\n%s", g.name, r, debug.Stack())
+			g.failed = true
+			n, err = 0, io.EOF
+		}
+	}()
+
+	return g.r.Read(buf)
+}
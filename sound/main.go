@@ -4,12 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"math"
-	"runtime"
+	"os"
 	"sync"
 	"time"
-
-	"github.com/hajimehoshi/oto/v2"
 )
 
 type Sound struct {
@@ -17,6 +14,10 @@ type Sound struct {
 	length   int64   // 576000
 	pos      int64   // 96000
 	function func(int64, float64) float64
+	params   map[string]*smoothed // this sound's copies of the params, see SetParam
+
+	fixed     func(uint32) int16 // replaces function with -fixed
+	phaseStep uint32             // phase advance per sample for fixed
 
 	remaining []byte // []
 }
@@ -25,16 +26,33 @@ var (
 	sampleRate      = flag.Int("samplerate", 48000, "sample rate")
 	channelCount    = flag.Int("channelcount", 2, "number of channel")
 	bitDepthInBytes = flag.Int("bitdepthinbytes", 2, "bit depth in bytes")
+	midiDevice      = flag.String("midi", "", "raw midi device to read control changes from (eg /dev/snd/midiC1D0)")
+	ccMappings      = flag.String("cc", "", "comma separated cc=param mappings (eg 7=gain)")
+	learnParam      = flag.String("learn", "", "param to bind to the next cc received from the midi device")
+	waveName        = flag.String("wave", "sine", "wave to play (sine, noise)")
+	backend         = flag.String("backend", "oto", "audio output (oto v2, aplay, raw pcm to stdout, oto3 for oto v3 when built with -tags oto3)")
+	fixedPoint      = flag.Bool("fixed", false, "render with Q15 fixed point oscillators and mixing instead of floats")
+	seed            = flag.Int64("seed", 0, "seed for all randomness, 0 picks one from the clock")
+	progressionName = flag.String("progression", "", "play a generated chord progression in this style (pop, jazz, modal) instead of the demo")
+	progressionKey  = flag.String("key", "C", "key of the -progression, eg C, F# or Bb")
+	progressionBars = flag.Int("bars", 8, "length of the -progression, a chord per bar")
+	barLength       = flag.Duration("bar", time.Second, "how long each chord of the -progression plays")
+	freeze          = flag.Bool("freeze", false, "start with the freeze param up: render every sound into memory before it starts playing and play it back from there, for sounds too heavy to render live")
 )
 
 func NewSound(freq float64, duration time.Duration, function func(int64, float64) float64) *Sound {
 	l := int64(*channelCount) * int64(*bitDepthInBytes) * int64(*sampleRate) * int64(duration) / int64(time.Second)
 
-	return &Sound{
+	s := &Sound{
 		freq:     freq,
 		length:   l,
 		function: function,
+		params:   map[string]*smoothed{},
 	}
+	for name, p := range params {
+		s.params[name] = newSmoothed(p)
+	}
+	return s
 }
 
 func (s *Sound) Read(buf []byte) (int, error) {
@@ -66,31 +84,35 @@ func (s *Sound) Read(buf []byte) (int, error) {
 	// so you can write info to it in the end (with a possible remainder that maybe wont fit in the original one)
 	var origBuf []byte
 	if len(buf)%4 > 0 {
-		fmt.Println("buf not divisible by 4", len(buf))
+		fmt.Fprintln(os.Stderr, "buf not divisible by 4", len(buf))
 		origBuf = buf
 		buf = make([]byte, len(origBuf)+4-len(origBuf)%4)
 	}
 
 	sampleFrequency := float64(*sampleRate) / float64(s.freq)
 
+	level := s.params[gain.name]
+
 	num := (*bitDepthInBytes) * (*channelCount)
 	// p is tracking the position in the wave - if buffer is size 12, you will store 13th piece of wave into first place of buffer (i)
 	p := s.pos / int64(num)
-	switch *bitDepthInBytes {
-	case 1:
+	switch {
+	case s.fixed != nil:
+		s.fillFixed(buf, p, level)
+	case *bitDepthInBytes == 1:
 		for i := 0; i < len(buf)/num; i++ {
 			const max = 127
-			b := int(s.function(p, sampleFrequency) * 0.3 * max)
+			b := int(s.function(p, sampleFrequency) * level.next(*sampleRate) * max)
 			for ch := 0; ch < *channelCount; ch++ {
 				buf[num*i+ch] = byte(b + 128)
 			}
 			p++
 		}
-	case 2:
+	case *bitDepthInBytes == 2:
 		for i := 0; i < len(buf)/num; i++ {
 			const max = 32767 // max 16 bit signed int
 			// b := int16(math.Sin(2*math.Pi*float64(p)/sampleFrequency) * 0.3 * max)
-			b := int16(s.function(p, sampleFrequency) * 0.3 * max)
+			b := int16(s.function(p, sampleFrequency) * level.next(*sampleRate) * max)
 			for ch := 0; ch < *channelCount; ch++ {
 				// since b can be bigger than byte(255), casting to byte will give b%255
 				// we keep b*2*2*2*2*2*2*2*2 in the next byte to tell us how much bigger the number is than 255
@@ -119,15 +141,50 @@ func (s *Sound) Read(buf []byte) (int, error) {
 	return n, nil
 }
 
-func play(context *oto.Context, freq float64, duration time.Duration) oto.Player {
-	p := context.NewPlayer(NewSound(freq, duration, func(i int64, f float64) float64 {
-		return math.Sin(2 * math.Pi * float64(i) / f)
-	}))
-	p.Play()
-	return p
+func play(sink AudioSink, s *Sound) {
+	name := fmt.Sprintf("sound %.1fHz", s.freq)
+	if frozen.get() >= 0.5 {
+		f, err := Freeze(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		sink.Play(guard(name, f))
+		return
+	}
+	sink.Play(guard(name, s))
+}
+
+func startMIDI() error {
+	ccs := newCCMap()
+	if err := ccs.parseCCMappings(*ccMappings); err != nil {
+		return err
+	}
+	if *learnParam != "" {
+		p, ok := params[*learnParam]
+		if !ok {
+			return fmt.Errorf("unknown param %q", *learnParam)
+		}
+		ccs.learn(p)
+	}
+
+	f, err := os.Open(*midiDevice)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer f.Close()
+		if err := listenMIDI(f, ccs); err != nil {
+			fmt.Fprintln(os.Stderr, "midi:", err)
+		}
+	}()
+	return nil
 }
 
 func run() error {
+	if *freeze {
+		frozen.set(1)
+	}
 
 	const (
 		freqC = 261.6
@@ -135,43 +192,52 @@ func run() error {
 		freqE = 329.6
 	)
 
-	c, ready, err := oto.NewContext(*sampleRate, *channelCount, *bitDepthInBytes)
+	sink, err := newSink(*backend, *sampleRate, *channelCount, *bitDepthInBytes)
 	if err != nil {
 		return err
 	}
-	<-ready
+
+	if *midiDevice != "" {
+		if err := startMIDI(); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := waves[*waveName]; !ok {
+		return fmt.Errorf("unknown wave %q", *waveName)
+	}
+	rnd := newEngineRand(*seed)
+
+	if *progressionName != "" {
+		if err := playProgression(sink, rnd); err != nil {
+			sink.Close()
+			return err
+		}
+		return sink.Close()
+	}
 
 	var wg sync.WaitGroup
-	var players []oto.Player
-	var m sync.Mutex
 
 	wg.Add(1)
+	voiceC := newVoice(*waveName, rnd.fork())
 	go func() {
 		defer wg.Done()
-		p := play(c, freqC, 3*time.Second)
-		m.Lock()
-		players = append(players, p)
-		m.Unlock()
+		play(sink, voiceC(freqC, 3*time.Second))
 		time.Sleep(3 * time.Second)
 	}()
 
 	wg.Add(1)
+	voiceD := newVoice(*waveName, rnd.fork())
 	go func() {
 		defer wg.Done()
 		time.Sleep(1 * time.Second)
-		p := play(c, freqD, 3*time.Second)
-		m.Lock()
-		players = append(players, p)
-		m.Unlock()
+		play(sink, voiceD(freqD, 3*time.Second))
 		time.Sleep(3 * time.Second)
 	}()
 
 	wg.Wait()
 
-	// Pin the players not to GC the players.
-	runtime.KeepAlive(players)
-
-	return nil
+	return sink.Close()
 }
 
 func main() {
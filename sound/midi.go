@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ccMap routes midi control change messages to engine params
+type ccMap struct {
+	mu       sync.Mutex
+	bindings map[byte]*param
+	learning *param // if set, the next cc that arrives gets bound to it
+}
+
+func newCCMap() *ccMap {
+	return &ccMap{bindings: map[byte]*param{}}
+}
+
+// parseCCMappings parses "7=gain,64=freeze" into the map
+func (m *ccMap) parseCCMappings(s string) error {
+	for _, mapping := range strings.Split(s, ",") {
+		if mapping == "" {
+			continue
+		}
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("bad cc mapping %q, expected cc=param", mapping)
+		}
+		cc, err := strconv.ParseUint(parts[0], 10, 7)
+		if err != nil {
+			return fmt.Errorf("bad cc number in %q: %w", mapping, err)
+		}
+		p, ok := params[parts[1]]
+		if !ok {
+			return fmt.Errorf("unknown param %q", parts[1])
+		}
+		m.bind(byte(cc), p)
+	}
+	return nil
+}
+
+func (m *ccMap) bind(cc byte, p *param) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bindings[cc] = p
+}
+
+func (m *ccMap) learn(p *param) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.learning = p
+	fmt.Fprintf(os.Stderr, "learning: move a knob to bind it to %s\n", p.name)
+}
+
+func (m *ccMap) handle(cc, value byte) {
+	m.mu.Lock()
+	if m.learning != nil {
+		m.bindings[cc] = m.learning
+		fmt.Fprintf(os.Stderr, "learned cc %d -> %s\n", cc, m.learning.name)
+		m.learning = nil
+	}
+	p := m.bindings[cc]
+	m.mu.Unlock()
+
+	if p == nil {
+		return
+	}
+	// cc values are 0-127, scale them into the param range
+	p.set(p.min + (p.max-p.min)*float64(value)/127)
+}
+
+// listenMIDI reads a raw midi byte stream (eg /dev/snd/midiC1D0) and feeds control changes into m
+func listenMIDI(r io.Reader, m *ccMap) error {
+	br := bufio.NewReader(r)
+
+	var status byte // last channel status byte, midi allows omitting it for repeated messages (running status)
+	var data []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case b >= 0xf8:
+			// realtime messages can show up anywhere and don't touch running status
+			continue
+		case b >= 0xf0:
+			// system common / sysex cancel running status, we don't care about their data
+			status = 0
+			data = data[:0]
+			continue
+		case b >= 0x80:
+			status = b
+			data = data[:0]
+			continue
+		}
+
+		if status == 0 {
+			continue
+		}
+		data = append(data, b)
+
+		// program change and channel pressure carry one data byte, everything else two
+		need := 2
+		if kind := status & 0xf0; kind == 0xc0 || kind == 0xd0 {
+			need = 1
+		}
+		if len(data) < need {
+			continue
+		}
+
+		if status&0xf0 == 0xb0 {
+			m.handle(data[0], data[1])
+		}
+		data = data[:0]
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the documented -cc examples, from the flag help, parseCCMappings and the freeze param
+var ccExamples = []string{"7=gain", "7=gain,64=freeze", "64=freeze"}
+
+func TestCCExamplesParse(t *testing.T) {
+	for _, s := range ccExamples {
+		if err := newCCMap().parseCCMappings(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
+
+func FuzzParseCCMappings(f *testing.F) {
+	for _, s := range ccExamples {
+		f.Add(s)
+	}
+	for _, s := range []string{"", ",", "=", "7=", "=gain", "128=gain", "-1=gain", "7=gain=freeze", "7=nope", "007=gain,,"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		m := newCCMap()
+		if err := m.parseCCMappings(s); err != nil {
+			return
+		}
+		for cc, p := range m.bindings {
+			if cc > 127 || p == nil {
+				t.Errorf("%q bound cc %d to %v", s, cc, p)
+			}
+		}
+	})
+}
+
+func FuzzListenMIDI(f *testing.F) {
+	for _, b := range [][]byte{
+		{0xb0, 7, 100},                   // a control change
+		{0xb0, 7, 100, 8, 50},            // and another with running status
+		{0xc0, 5, 0xb0, 64, 127},         // a program change has one data byte
+		{0xf0, 1, 2, 3, 0xf7, 7, 100},    // sysex data isn't a control change
+		{0xb0, 7, 0xf8, 100},             // a realtime clock in the middle of a message
+		{0xb0},                           // cut short
+		{7, 100, 0xff, 0xb0, 0xb0, 0x80}, // data without a status, and statuses without data
+	} {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if err := listenMIDI(bytes.NewReader(b), newCCMap()); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// param is an engine parameter that can be changed live from another goroutine
+// (e.g. a midi knob) while the audio goroutines are reading it
+type param struct {
+	name string
+	min  float64
+	max  float64
+	bits uint64 // float64 value, accessed atomically
+}
+
+func newParam(name string, value, min, max float64) *param {
+	p := &param{name: name, min: min, max: max}
+	p.set(value)
+	return p
+}
+
+func (p *param) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&p.bits))
+}
+
+func (p *param) set(v float64) {
+	atomic.StoreUint64(&p.bits, math.Float64bits(clamp(p, v)))
+}
+
+func clamp(p *param, v float64) float64 {
+	return math.Max(p.min, math.Min(p.max, v))
+}
+
+var gain = newParam("gain", 0.3, 0, 1)
+
+// frozen above half freezes the sounds that start playing, and unfreezes the frozen ones as soon as it drops
+// below, so a pedal or a button bound with -cc 64=freeze is the one move it takes to get them live again
+var frozen = newParam("freeze", 0, 0, 1)
+
+var params = map[string]*param{
+	gain.name:   gain,
+	frozen.name: frozen,
+}
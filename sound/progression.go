@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// a progression is generated from the scale of a key: chords are stacked thirds on its degrees, so they
+// always fit the key, and each style picks the degrees its own way. the same seed gives the same chords
+
+// chord is a set of midi notes, lowest first
+type chord struct {
+	name  string
+	notes []int
+}
+
+// progressionStyle picks the scale and the degrees (0 based) of the chords, one per bar
+type progressionStyle struct {
+	scale    []int
+	sevenths bool
+	next     func(r *rand.Rand, bars int) []int
+}
+
+var (
+	majorScale  = []int{0, 2, 4, 5, 7, 9, 11}
+	dorianScale = []int{0, 2, 3, 5, 7, 9, 10}
+)
+
+var progressionStyles = map[string]progressionStyle{
+	// four bar phrases of the usual I V vi IV family
+	"pop": {scale: majorScale, next: phrases([][]int{
+		{0, 4, 5, 3}, {5, 3, 0, 4}, {0, 5, 3, 4}, {0, 3, 5, 4},
+	})},
+	// ii V I turnarounds, with sevenths
+	"jazz": {scale: majorScale, sevenths: true, next: phrases([][]int{
+		{1, 4, 0, 0}, {1, 4, 0, 5}, {2, 5, 1, 4},
+	})},
+	// a dorian vamp that wanders between i, ii, IV and bVII, but keeps coming home
+	"modal": {scale: dorianScale, next: func(r *rand.Rand, bars int) []int {
+		moves := []int{0, 1, 3, 6}
+		degrees := make([]int, bars)
+		for i := range degrees {
+			if i%2 == 1 {
+				degrees[i] = moves[1+r.Intn(len(moves)-1)]
+			}
+		}
+		return degrees
+	}},
+}
+
+// phrases strings together randomly picked four bar phrases
+func phrases(options [][]int) func(r *rand.Rand, bars int) []int {
+	return func(r *rand.Rand, bars int) []int {
+		var degrees []int
+		for len(degrees) < bars {
+			degrees = append(degrees, options[r.Intn(len(options))]...)
+		}
+		return degrees[:bars]
+	}
+}
+
+var noteNames = []string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// parseKey takes a note name like C, F# or Bb and returns its pitch class
+func parseKey(key string) (int, error) {
+	if key == "" {
+		return 0, fmt.Errorf("empty key")
+	}
+	pc := strings.Index("C D EF G A B", strings.ToUpper(key[:1]))
+	if pc < 0 || key[0] == ' ' {
+		return 0, fmt.Errorf("unknown key %q", key)
+	}
+	for _, accidental := range key[1:] {
+		switch accidental {
+		case '#':
+			pc++
+		case 'b':
+			pc--
+		default:
+			return 0, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return (pc + 12) % 12, nil
+}
+
+// generateProgression makes bars chords in key, the root in the octave below middle c
+func generateProgression(key int, style progressionStyle, bars int, r *rand.Rand) []chord {
+	chords := make([]chord, 0, bars)
+	for _, degree := range style.next(r, bars) {
+		stack := 3
+		if style.sevenths {
+			stack = 4
+		}
+		var notes []int
+		for i := 0; i < stack; i++ {
+			d := degree + 2*i
+			notes = append(notes, 48+key+style.scale[d%7]+12*(d/7))
+		}
+		chords = append(chords, chord{name: chordName(notes), notes: notes})
+	}
+	return chords
+}
+
+// chordName names a stack of thirds by its intervals from the root
+func chordName(notes []int) string {
+	third, fifth := notes[1]-notes[0], notes[2]-notes[0]
+	quality := ""
+	switch {
+	case third == 3 && fifth == 6:
+		quality = "°"
+	case third == 3:
+		quality = "m"
+	}
+	if len(notes) > 3 {
+		switch seventh := notes[3] - notes[0]; {
+		case quality == "°" && seventh == 10:
+			quality = "m7b5"
+		case quality == "" && seventh == 11:
+			quality = "maj7"
+		default:
+			quality += "7"
+		}
+	}
+	return noteNames[notes[0]%12] + quality
+}
+
+func midiFreq(note int) float64 {
+	return 440 * math.Pow(2, float64(note-69)/12)
+}
+
+// playProgression plays a generated progression, a chord per bar, and prints it so a backing track can
+// be written down or regenerated with the same -seed
+func playProgression(sink AudioSink, rnd *engineRand) error {
+	style, ok := progressionStyles[*progressionName]
+	if !ok {
+		return fmt.Errorf("unknown progression style %q (pop, jazz, modal)", *progressionName)
+	}
+	key, err := parseKey(*progressionKey)
+	if err != nil {
+		return err
+	}
+	if *progressionBars <= 0 {
+		return fmt.Errorf("-bars has to be more than 0, not %d", *progressionBars)
+	}
+	chords := generateProgression(key, style, *progressionBars, rnd.fork())
+
+	names := make([]string, len(chords))
+	for i, c := range chords {
+		names[i] = c.name
+	}
+	fmt.Fprintln(os.Stderr, "progression:", strings.Join(names, " "))
+
+	for _, c := range chords {
+		for _, note := range c.notes {
+			// every note gets its own PRNG, like every sound should
+			s := newVoice(*waveName, rnd.fork())(midiFreq(note), *barLength)
+			// keep a chord as loud as a three note one
+			s.SetParam(gain.name, gain.get()*3/float64(len(c.notes)), 0)
+			play(sink, s)
+		}
+		time.Sleep(*barLength)
+	}
+	return nil
+}
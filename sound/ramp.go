@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// rampTarget is a requested change of a smoothed param, replaced as a whole so the audio goroutine
+// never sees a value from one request with the duration of another
+type rampTarget struct {
+	value    float64
+	duration time.Duration
+}
+
+// smoothed is a node's own copy of a param. it can be set from any goroutine (osc, midi, ...),
+// but the value only moves in the audio goroutine, linearly over the ramp, so a jump in the
+// control value never ends up as a click in the output however late or jittery the control messages are
+type smoothed struct {
+	p      *param
+	target atomic.Value // *rampTarget
+
+	// audio goroutine only
+	seen   *rampTarget
+	cur    float64
+	step   float64
+	left   int     // samples until the target is reached
+	global float64 // last value of p we followed
+
+	// the same ramp for -fixed, in Q15 with 16 more bits of fraction so slow ramps still move
+	curQ, stepQ int64
+}
+
+// followRamp is how long a node takes to follow a change of the shared param, eg from a midi knob
+const followRamp = 10 * time.Millisecond
+
+func newSmoothed(p *param) *smoothed {
+	s := &smoothed{p: p, cur: p.get(), curQ: rampQ15(p.get()), global: p.get()}
+	s.target.Store(&rampTarget{value: s.cur})
+	return s
+}
+
+func (s *smoothed) set(value float64, ramp time.Duration) {
+	value = clamp(s.p, value)
+	s.target.Store(&rampTarget{value: value, duration: ramp})
+}
+
+// next is the value for the next sample
+func (s *smoothed) next(sampleRate int) float64 {
+	if g := s.p.get(); g != s.global {
+		s.global = g
+		s.set(g, followRamp)
+	}
+
+	if t := s.target.Load().(*rampTarget); t != s.seen {
+		s.seen = t
+		s.left = int(int64(t.duration) * int64(sampleRate) / int64(time.Second))
+		if s.left == 0 {
+			s.cur = t.value
+		} else {
+			s.step = (t.value - s.cur) / float64(s.left)
+		}
+	}
+
+	if s.left > 0 {
+		s.left--
+		s.cur += s.step
+		if s.left == 0 {
+			s.cur = s.seen.value // no float drift at the end
+		}
+	}
+	return s.cur
+}
+
+// nextQ15 is next for -fixed, only a new target is converted from a float, the steps in between are integer
+func (s *smoothed) nextQ15(sampleRate int) int16 {
+	if g := s.p.get(); g != s.global {
+		s.global = g
+		s.set(g, followRamp)
+	}
+
+	if t := s.target.Load().(*rampTarget); t != s.seen {
+		s.seen = t
+		s.left = int(int64(t.duration) * int64(sampleRate) / int64(time.Second))
+		if s.left == 0 {
+			s.curQ = rampQ15(t.value)
+		} else {
+			s.stepQ = (rampQ15(t.value) - s.curQ) / int64(s.left)
+		}
+	}
+
+	if s.left > 0 {
+		s.left--
+		s.curQ += s.stepQ
+		if s.left == 0 {
+			s.curQ = rampQ15(s.seen.value) // what the division left out
+		}
+	}
+	return int16(s.curQ >> 16)
+}
+
+func rampQ15(v float64) int64 {
+	return int64(math.Round(v*math.MaxInt16)) << 16
+}
+
+// SetParam glides the node's param name to value over ramp, 0 jumps straight to it
+func (s *Sound) SetParam(name string, value float64, ramp time.Duration) error {
+	p, ok := s.params[name]
+	if !ok {
+		return fmt.Errorf("unknown param %q", name)
+	}
+	p.set(value, ramp)
+	return nil
+}
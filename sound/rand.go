@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// engineRand is the only source of randomness in the engine.
+// every sound forks its own PRNG off it when it's created, so what a sound renders
+// only depends on the seed and not on how oto interleaves reads across players
+type engineRand struct {
+	src *rand.Rand
+}
+
+// newEngineRand seeds the engine, a seed of 0 picks one from the clock.
+// the seed is printed either way so a render can be reproduced with -seed
+func newEngineRand(seed int64) *engineRand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	fmt.Fprintln(os.Stderr, "seed:", seed)
+	return &engineRand{src: rand.New(rand.NewSource(seed))}
+}
+
+// fork is not safe for concurrent use, call it before handing the PRNG to a goroutine
+func (e *engineRand) fork() *rand.Rand {
+	return rand.New(rand.NewSource(e.src.Int63()))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// AudioSink is the output device, the engine only plays sounds on it so swapping
+// backends (or upgrading one) doesn't touch anything else
+type AudioSink interface {
+	// Play starts mixing r into the output, until r returns io.EOF
+	Play(r io.Reader)
+	Close() error
+}
+
+// sinks are the backends selectable with -backend
+var sinks = map[string]func(sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error){
+	"oto":   newOtoSink,
+	"aplay": newAplaySink,
+	"raw":   newStdoutSink,
+}
+
+func newSink(name string, sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error) {
+	open, ok := sinks[name]
+	if !ok {
+		names := make([]string, 0, len(sinks))
+		for name := range sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown backend %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return open(sampleRate, channelCount, bitDepthInBytes)
+}
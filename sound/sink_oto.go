@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"sync"
+
+	"github.com/hajimehoshi/oto/v2"
+)
+
+// otoSink plays through oto v2, which mixes the players itself
+type otoSink struct {
+	context *oto.Context
+
+	mu      sync.Mutex
+	players []oto.Player // referenced so they aren't garbage collected while playing
+}
+
+func newOtoSink(sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error) {
+	c, ready, err := oto.NewContext(sampleRate, channelCount, bitDepthInBytes)
+	if err != nil {
+		return nil, err
+	}
+	<-ready
+	return &otoSink{context: c}, nil
+}
+
+func (s *otoSink) Play(r io.Reader) {
+	p := s.context.NewPlayer(r)
+	p.Play()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players = append(s.players, p)
+}
+
+func (s *otoSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		p.Close()
+	}
+	s.players = nil
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build oto3
+// +build oto3
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// oto v3 needs cgo and the alsa headers on linux, so it's only built with -tags oto3
+func init() {
+	sinks["oto3"] = newOto3Sink
+}
+
+// oto3Sink plays through oto v3, which like v2 mixes the players itself
+type oto3Sink struct {
+	context *oto.Context
+
+	mu      sync.Mutex
+	players []*oto.Player // referenced so they aren't garbage collected while playing
+}
+
+func newOto3Sink(sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error) {
+	format := oto.FormatSignedInt16LE
+	switch bitDepthInBytes {
+	case 1:
+		format = oto.FormatUnsignedInt8
+	case 2:
+	default:
+		return nil, fmt.Errorf("oto v3 only does 8 and 16 bit, not %d bytes", bitDepthInBytes)
+	}
+	c, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   sampleRate,
+		ChannelCount: channelCount,
+		Format:       format,
+	})
+	if err != nil {
+		return nil, err
+	}
+	<-ready
+	return &oto3Sink{context: c}, nil
+}
+
+func (s *oto3Sink) Play(r io.Reader) {
+	p := s.context.NewPlayer(r)
+	p.Play()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players = append(s.players, p)
+}
+
+func (s *oto3Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		p.Close()
+	}
+	s.players = nil
+	return s.context.Err()
+}
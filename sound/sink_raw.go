@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// rawSink mixes the playing sounds itself and writes them as interleaved pcm, in real time so sounds
+// started later (eg after a sleep) land where they should, and silence while nothing is playing
+type rawSink struct {
+	w               io.WriteCloser
+	sampleRate      int
+	channelCount    int
+	bitDepthInBytes int
+	fixed           bool // mix in Q15 integers, for -fixed
+
+	mu      sync.Mutex
+	playing []io.Reader
+	err     error // first write error, the output is gone after one
+
+	stopped chan struct{}
+	done    chan struct{}
+	closed  func() error // waits for whatever reads w, if anything
+}
+
+// mix 10ms at a time
+const rawChunk = 10 * time.Millisecond
+
+func newRawSink(w io.WriteCloser, sampleRate, channelCount, bitDepthInBytes int) (*rawSink, error) {
+	if bitDepthInBytes != 1 && bitDepthInBytes != 2 {
+		return nil, fmt.Errorf("raw output only does 8 and 16 bit, not %d bytes", bitDepthInBytes)
+	}
+	s := &rawSink{
+		w:               w,
+		sampleRate:      sampleRate,
+		channelCount:    channelCount,
+		bitDepthInBytes: bitDepthInBytes,
+		fixed:           *fixedPoint,
+		stopped:         make(chan struct{}),
+		done:            make(chan struct{}),
+		closed:          func() error { return nil },
+	}
+	go s.run()
+	return s, nil
+}
+
+// newStdoutSink writes raw pcm to stdout, eg for `go run . -backend raw | aplay -f S16_LE -r 48000 -c 2`
+func newStdoutSink(sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error) {
+	return newRawSink(keepOpen{os.Stdout}, sampleRate, channelCount, bitDepthInBytes)
+}
+
+// keepOpen is a writer the sink can close without closing what's under it, stdout is the process's
+type keepOpen struct {
+	io.Writer
+}
+
+func (keepOpen) Close() error { return nil }
+
+// newAplaySink pipes raw pcm into the aplay binary, which needs no cgo or alsa headers to build. it isn't
+// an alsa writer of its own, aplay opens the default device
+func newAplaySink(sampleRate, channelCount, bitDepthInBytes int) (AudioSink, error) {
+	format := "S16_LE"
+	if bitDepthInBytes == 1 {
+		format = "U8"
+	}
+	cmd := exec.Command("aplay", "-q", "-t", "raw", "-f", format,
+		"-r", fmt.Sprint(sampleRate), "-c", fmt.Sprint(channelCount))
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	s, err := newRawSink(in, sampleRate, channelCount, bitDepthInBytes)
+	if err != nil {
+		in.Close()
+		cmd.Wait()
+		return nil, err
+	}
+	s.closed = cmd.Wait
+	return s, nil
+}
+
+func (s *rawSink) Play(r io.Reader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playing = append(s.playing, r)
+}
+
+func (s *rawSink) run() {
+	defer close(s.done)
+
+	frame := s.channelCount * s.bitDepthInBytes
+	frames := int(int64(s.sampleRate) * int64(rawChunk) / int64(time.Second))
+	mixed := make([]float64, frames*s.channelCount)
+	mixedQ15 := make([]int32, frames*s.channelCount)
+	buf := make([]byte, frames*frame)
+	in := make([]byte, frames*frame)
+
+	start := time.Now()
+	for written := 0; ; written += frames {
+		select {
+		case <-s.stopped:
+			return
+		default:
+		}
+
+		for i := range mixed {
+			mixed[i], mixedQ15[i] = 0, 0
+		}
+		s.mu.Lock()
+		playing := s.playing[:0]
+		for _, r := range s.playing {
+			n, err := io.ReadFull(r, in)
+			for i := 0; i < n/s.bitDepthInBytes; i++ {
+				if s.fixed {
+					mixedQ15[i] += int32(s.decodeQ15(in[i*s.bitDepthInBytes:]))
+				} else {
+					mixed[i] += s.decode(in[i*s.bitDepthInBytes:])
+				}
+			}
+			if err == nil {
+				playing = append(playing, r)
+			}
+		}
+		s.playing = playing
+		s.mu.Unlock()
+
+		for i := range mixed {
+			if s.fixed {
+				s.encodeQ15(buf[i*s.bitDepthInBytes:], saturate(mixedQ15[i]))
+			} else {
+				s.encode(buf[i*s.bitDepthInBytes:], math.Max(-1, math.Min(1, mixed[i])))
+			}
+		}
+		if _, err := s.w.Write(buf); err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			return
+		}
+
+		// don't run ahead of the clock, a pipe to aplay blocks on its own but stdout to a file doesn't
+		ahead := time.Duration(written+frames)*time.Second/time.Duration(s.sampleRate) - time.Since(start)
+		if ahead > 0 {
+			time.Sleep(ahead)
+		}
+	}
+}
+
+func (s *rawSink) decode(b []byte) float64 {
+	if s.bitDepthInBytes == 1 {
+		return float64(int(b[0])-128) / 127
+	}
+	return float64(int16(uint16(b[0])|uint16(b[1])<<8)) / 32767
+}
+
+func (s *rawSink) encode(b []byte, v float64) {
+	if s.bitDepthInBytes == 1 {
+		b[0] = byte(int(v*127) + 128)
+		return
+	}
+	x := int16(v * 32767)
+	b[0] = byte(x)
+	b[1] = byte(x >> 8)
+}
+
+func (s *rawSink) decodeQ15(b []byte) int16 {
+	if s.bitDepthInBytes == 1 {
+		return int16(int(b[0])-128) << 8
+	}
+	return int16(uint16(b[0]) | uint16(b[1])<<8)
+}
+
+func (s *rawSink) encodeQ15(b []byte, v int16) {
+	if s.bitDepthInBytes == 1 {
+		b[0] = byte(int(v>>8) + 128)
+		return
+	}
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+}
+
+func (s *rawSink) Close() error {
+	close(s.stopped)
+	<-s.done
+
+	err := s.w.Close()
+	if werr := s.closed(); err == nil {
+		err = werr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
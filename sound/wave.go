@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// waves builds the function a Sound samples for each point p, given the number of samples in one period
+var waves = map[string]func(r *rand.Rand) func(int64, float64) float64{
+	"sine": func(*rand.Rand) func(int64, float64) float64 {
+		return func(i int64, f float64) float64 {
+			return math.Sin(2 * math.Pi * float64(i) / f)
+		}
+	},
+	// white noise, frequency is ignored
+	"noise": func(r *rand.Rand) func(int64, float64) float64 {
+		return func(int64, float64) float64 {
+			return r.Float64()*2 - 1
+		}
+	},
+}
+
+// voice makes the Sounds of one wave, with the float or the -fixed renderer
+type voice func(freq float64, duration time.Duration) *Sound
+
+// newVoice takes the name of one of the waves, and the PRNG all of its sounds share
+func newVoice(wave string, r *rand.Rand) voice {
+	if *fixedPoint {
+		function := fixedWaves[wave](r)
+		return func(freq float64, duration time.Duration) *Sound {
+			return NewFixedSound(freq, duration, function)
+		}
+	}
+	function := waves[wave](r)
+	return func(freq float64, duration time.Duration) *Sound {
+		return NewSound(freq, duration, function)
+	}
+}
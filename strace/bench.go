@@ -0,0 +1,238 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// benchRun is what a single traced run of a command did
+type benchRun map[string]*benchCount
+
+type benchCount struct {
+	calls int
+	time  time.Duration
+}
+
+// runBench implements `bench [-n N] -- cmdA args -- cmdB args ...`, tracing every command n times
+// and printing their syscall counts and times side by side
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	reps := fs.Int("n", 1, "how many times to run each command")
+	filterExpr := fs.String("e", "", "only count these comma separated syscalls")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s bench [flags] -- <cmdA> [args...] -- <cmdB> [args...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cmds := splitCommands(fs.Args())
+	if len(cmds) == 0 || *reps < 1 {
+		fs.Usage()
+		return 2
+	}
+	filter, err := parseFilter(*filterExpr, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return benchCommands(cmds, filter, *reps)
+}
+
+// repeatCommand is -repeat, bench with a single command: short tools vary a lot from one run to the next,
+// so a single trace of them can't be trusted much
+func repeatCommand(cmd []string, filter *syscallFilter, reps int) int {
+	return benchCommands([][]string{cmd}, filter, reps)
+}
+
+func benchCommands(cmds [][]string, filter *syscallFilter, reps int) int {
+	runs := make([][]benchRun, len(cmds))
+	for i, cmd := range cmds {
+		for n := 0; n < reps; n++ {
+			fmt.Fprintf(os.Stderr, ">>>run %d/%d of %s\n", n+1, reps, strings.Join(cmd, " "))
+			run, err := benchOnce(cmd, filter)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			runs[i] = append(runs[i], run)
+		}
+	}
+
+	printBench(os.Stdout, cmds, runs)
+	return 0
+}
+
+// splitCommands splits "ls -la -- find ." into its commands
+func splitCommands(args []string) [][]string {
+	var cmds [][]string
+	var cur []string
+	for _, a := range args {
+		if a == "--" {
+			if len(cur) > 0 {
+				cmds = append(cmds, cur)
+			}
+			cur = nil
+			continue
+		}
+		cur = append(cur, a)
+	}
+	if len(cur) > 0 {
+		cmds = append(cmds, cur)
+	}
+	return cmds
+}
+
+func benchOnce(args []string, filter *syscallFilter) (benchRun, error) {
+	run := benchRun{}
+	t := strace.New(strace.Options{
+		OnSyscall: func(e strace.SyscallEvent) {
+			if e.Stage != strace.Exit || !filter.match(e.Name) {
+				return
+			}
+			c, ok := run[e.Name]
+			if !ok {
+				c = &benchCount{}
+				run[e.Name] = c
+			}
+			c.calls++
+			c.time += e.Duration
+		},
+	})
+
+	// the output of benchmarked commands is discarded
+	if _, err := t.Run(exec.Command(args[0], args[1:]...)); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func printBench(w io.Writer, cmds [][]string, runs [][]benchRun) {
+	seen := map[string]bool{}
+	for _, cmdRuns := range runs {
+		for _, run := range cmdRuns {
+			for name := range run {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, cmd := range cmds {
+		fmt.Fprintf(w, "[%c] %s\n", 'A'+i, strings.Join(cmd, " "))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%-20s", "SYSCALL")
+	for i := range cmds {
+		fmt.Fprintf(w, " %22s %26s", fmt.Sprintf("[%c] CALLS", 'A'+i), fmt.Sprintf("[%c] TIME", 'A'+i))
+	}
+	fmt.Fprintln(w)
+
+	row := func(label string, pick func(benchRun) (float64, float64)) {
+		fmt.Fprintf(w, "%-20s", label)
+		for _, cmdRuns := range runs {
+			calls := make([]float64, len(cmdRuns))
+			times := make([]float64, len(cmdRuns))
+			for i, run := range cmdRuns {
+				calls[i], times[i] = pick(run)
+			}
+			cm, cs := meanStddev(calls)
+			tm, ts := meanStddev(times)
+			fmt.Fprintf(w, " %22s %26s",
+				fmt.Sprintf("%.1f ±%.1f", cm, cs),
+				fmt.Sprintf("%v ±%v", time.Duration(tm).Round(time.Microsecond), time.Duration(ts).Round(time.Microsecond)))
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, name := range names {
+		row(name, func(run benchRun) (float64, float64) {
+			if c, ok := run[name]; ok {
+				return float64(c.calls), float64(c.time)
+			}
+			return 0, 0
+		})
+	}
+	row("total", func(run benchRun) (float64, float64) {
+		var calls, t float64
+		for _, c := range run {
+			calls += float64(c.calls)
+			t += float64(c.time)
+		}
+		return calls, t
+	})
+}
+
+// meanStddev is the mean and sample standard deviation of xs
+func meanStddev(xs []float64) (float64, float64) {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(xs)-1))
+}
+
+// overheadCommand is -benchmark: it runs the command untraced and then traced, reps times each, to show how
+// much tracing slows it down, in all and per syscall stop. a command that's a lot slower traced does less in
+// the same time, which is worth knowing before reading too much into its syscall times
+func overheadCommand(args []string, follow bool, reps int) int {
+	var untraced, traced, stops []float64
+	for n := 0; n < reps; n++ {
+		fmt.Fprintf(os.Stderr, ">>>run %d/%d of %s\n", n+1, reps, strings.Join(args, " "))
+		start := time.Now()
+		// the exit status doesn't matter, only how long it took, as long as it ran
+		if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		untraced = append(untraced, float64(time.Since(start)))
+
+		count := 0
+		t := strace.New(strace.Options{Follow: follow, OnSyscall: func(strace.SyscallEvent) { count++ }})
+		start = time.Now()
+		if _, err := t.Run(exec.Command(args[0], args[1:]...)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		traced = append(traced, float64(time.Since(start)))
+		stops = append(stops, float64(count))
+	}
+
+	um, us := meanStddev(untraced)
+	tm, ts := meanStddev(traced)
+	sm, _ := meanStddev(stops)
+	round := func(ns float64) time.Duration { return time.Duration(ns).Round(time.Microsecond) }
+	fmt.Printf(">>>untraced %v ±%v\n", round(um), round(us))
+	fmt.Printf(">>>traced   %v ±%v, %.0f syscall stops\n", round(tm), round(ts), sm)
+	perStop := time.Duration(0)
+	if sm > 0 {
+		perStop = time.Duration((tm - um) / sm)
+	}
+	fmt.Printf(">>>overhead %v (%+.0f%%), %v per stop\n", round(tm-um), 100*(tm-um)/um, perStop.Round(10*time.Nanosecond))
+	return 0
+}
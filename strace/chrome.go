@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// chromeTrace collects syscalls in the chrome trace-event format
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+// which can be opened in about://tracing or https://ui.perfetto.dev
+type chromeTrace struct {
+	start  time.Time
+	events []chromeEvent
+	tgids  threadGroups // nil for a replay, its tids are long gone from /proc
+}
+
+type chromeEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat,omitempty"`
+	Ph   string            `json:"ph"`
+	Ts   float64           `json:"ts"` // microseconds since start
+	Dur  float64           `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// newChromeTrace groups threads under their process when live, a replay only has the tids to go by
+func newChromeTrace(live bool) *chromeTrace {
+	t := &chromeTrace{start: time.Now()}
+	if live {
+		t.tgids = threadGroups{}
+	}
+	return t
+}
+
+// processName labels the track of pid in the viewer
+func (t *chromeTrace) processName(pid int, name string) {
+	t.events = append(t.events, chromeEvent{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  pid,
+		Tid:  pid,
+		Args: map[string]string{"name": name},
+	})
+}
+
+// add records a complete ("X") event spanning syscall enter to exit, on the thread's track in its process
+func (t *chromeTrace) add(tid int, name string, enter, exit time.Time) {
+	pid := tid
+	if t.tgids != nil {
+		pid = t.tgids.of(tid)
+	}
+	t.events = append(t.events, chromeEvent{
+		Name: name,
+		Cat:  "syscall",
+		Ph:   "X",
+		Ts:   micros(enter.Sub(t.start)),
+		Dur:  micros(exit.Sub(enter)),
+		Pid:  pid,
+		Tid:  tid,
+	})
+}
+
+func (t *chromeTrace) write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{t.events, "ns"})
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// longest sequence of calls -collapse folds
+const collapsePeriod = 4
+
+// callKey is what makes two printed calls the same, their data and how much of it aside
+type callKey struct {
+	name  string
+	args  [6]uint64
+	errno int64
+}
+
+func newCallKey(name string, args [6]uint64, ret int64) callKey {
+	k := callKey{name: name, args: args}
+	if ret < 0 && ret > -4096 {
+		k.errno = ret
+	}
+	return k
+}
+
+// collapser folds a call, or a sequence of up to collapsePeriod calls, that a tracee makes over and over into
+// a single "... repeated n times" line with the bytes and time of them all, for -collapse
+type collapser struct {
+	pids map[int]*repeats
+}
+
+// repeats are the calls of one tracee that were printed last, and the sequence it's repeating if it is
+type repeats struct {
+	history []callKey
+	run     []callKey // nil when nothing is repeating
+	next    int       // where in run the next call is expected
+	count   int       // whole repetitions of run so far
+	pending []string  // lines of the repetition that isn't whole yet, printed if it doesn't get there
+	bytes   int64     // of the whole repetitions
+	time    time.Duration
+
+	pendingBytes int64
+	pendingTime  time.Duration
+}
+
+func newCollapser() *collapser {
+	return &collapser{pids: map[int]*repeats{}}
+}
+
+// lines takes a call that's about to be printed as line and returns what to print instead, nothing while
+// it's part of a repetition
+func (c *collapser) lines(pid int, key callKey, line string, bytes int64, d time.Duration) []string {
+	r, ok := c.pids[pid]
+	if !ok {
+		r = &repeats{}
+		c.pids[pid] = r
+	}
+	var out []string
+	if r.run != nil {
+		if key == r.run[r.next] {
+			r.repeat(line, bytes, d)
+			return nil
+		}
+		out = r.end()
+	}
+
+	for p := 1; p <= len(r.history); p++ {
+		if r.history[len(r.history)-p] == key {
+			r.run = append([]callKey(nil), r.history[len(r.history)-p:]...)
+			r.repeat(line, bytes, d)
+			return out
+		}
+	}
+	if r.history = append(r.history, key); len(r.history) > collapsePeriod {
+		r.history = r.history[1:]
+	}
+	return append(out, line)
+}
+
+func (r *repeats) repeat(line string, bytes int64, d time.Duration) {
+	r.pending = append(r.pending, line)
+	r.pendingBytes += bytes
+	r.pendingTime += d
+	if r.next++; r.next == len(r.run) {
+		r.bytes += r.pendingBytes
+		r.time += r.pendingTime
+		r.next, r.pending, r.pendingBytes, r.pendingTime = 0, nil, 0, 0
+		r.count++
+	}
+}
+
+// end is the lines of a repetition that just stopped, and starts looking for the next one
+func (r *repeats) end() []string {
+	var out []string
+	if r.count > 0 {
+		what := "... repeated"
+		if len(r.run) > 1 {
+			what = fmt.Sprintf("... the last %d calls repeated", len(r.run))
+		}
+		summary := fmt.Sprintf("%s %d times, %v", what, r.count, r.time)
+		if r.bytes > 0 {
+			summary = fmt.Sprintf("%s %d times, %d bytes in %v", what, r.count, r.bytes, r.time)
+		}
+		out = append(out, paint(colorDim, summary))
+	}
+	out = append(out, r.pending...)
+	*r = repeats{}
+	return out
+}
+
+// flush prints what's left of the repetition of pid, when it exits
+func (c *collapser) flush(w io.Writer, pid int) {
+	if r, ok := c.pids[pid]; ok {
+		for _, line := range r.end() {
+			fmt.Fprintf(w, "%s%s\n", pidColumn(pid), line)
+		}
+		delete(c.pids, pid)
+	}
+}
+
+// flushAll prints what's left of every repetition, at the end of the trace
+func (c *collapser) flushAll(w io.Writer) {
+	pids := make([]int, 0, len(c.pids))
+	for pid := range c.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		c.flush(w, pid)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// live trace lines are colored and aligned on a terminal: syscall names stand out, errors are red and
+// results line up in a column like strace's. -no-color or $NO_COLOR turn it off, and so does anything
+// that isn't a terminal, so files and pipes get plain text
+var colorOutput bool
+
+const (
+	colorDim   = "2"
+	colorError = "31"
+	colorSlow  = "33"
+	colorName  = "36"
+
+	colorSecurity = "1;35"
+
+	// results start at this column, after the call
+	resultColumn = 40
+)
+
+func paint(code, s string) string {
+	if !colorOutput {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// pidColumn starts every live line, padded so whatever follows lines up
+func pidColumn(pid int) string {
+	return paint(colorDim, fmt.Sprintf("%-7s", fmt.Sprintf("[%d]", pid))) + " "
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// envVars collects repeated -env KEY=VAL flags, added to (or replacing in) our own environment for the command
+type envVars []string
+
+func (e *envVars) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *envVars) Set(v string) error {
+	if key, _, ok := strings.Cut(v, "="); !ok || key == "" {
+		return fmt.Errorf("bad -env %q, expected KEY=VAL", v)
+	}
+	*e = append(*e, v)
+	return nil
+}
+
+// commandFlagsSet reports whether any of the flags that shape the started command were given
+func commandFlagsSet() bool {
+	return *stdoutPath != "" || *stderrPath != "" || *annotateOutput ||
+		len(env) > 0 || *chdir != "" || *runAsUID >= 0 || *runAsGID >= 0
+}
+
+// setupCommand applies -env, -chdir, -uid and -gid to the command before it's started
+func setupCommand(cmd *exec.Cmd) {
+	if len(env) > 0 {
+		// later entries win in exec, so these override ours
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Dir = *chdir
+
+	if *runAsUID >= 0 || *runAsGID >= 0 {
+		uid, gid := os.Getuid(), os.Getgid()
+		if *runAsUID >= 0 {
+			uid = *runAsUID
+		}
+		if *runAsGID >= 0 {
+			gid = *runAsGID
+		}
+		// without Groups it also drops our supplementary groups, which is what running as someone else means
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// controlCommand runs a -control command with its argument, writing what it has to say to w
+type controlCommand func(w io.Writer, arg string) error
+
+// controlServer takes commands on a unix socket, one per line, so a long trace can be changed without
+// starting it again:
+//
+//	echo pause | nc -U /tmp/strace.sock
+//
+// every command runs with mu held, which the tracing goroutine holds while it handles an event
+type controlServer struct {
+	mu       sync.Mutex
+	l        net.Listener
+	commands map[string]controlCommand
+}
+
+func newControlServer(path string, commands map[string]controlCommand) (*controlServer, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &controlServer{l: l, commands: commands}
+	go c.serve()
+	return c, nil
+}
+
+func (c *controlServer) serve() {
+	for {
+		conn, err := c.l.Accept()
+		if err != nil {
+			return
+		}
+		go c.session(conn)
+	}
+}
+
+// session answers every command with ok or an error, after what the command printed
+func (c *controlServer) session(conn net.Conn) {
+	defer conn.Close()
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		name, arg, _ := strings.Cut(strings.TrimSpace(s.Text()), " ")
+		if name == "" {
+			continue
+		}
+		command, ok := c.commands[name]
+		if !ok {
+			fmt.Fprintf(conn, "error: unknown command %q, expected one of %s\n", name, strings.Join(c.names(), ", "))
+			continue
+		}
+		c.mu.Lock()
+		err := command(conn, strings.TrimSpace(arg))
+		if err == nil {
+			fmt.Printf(">>>control: %s\n", strings.TrimSpace(s.Text()))
+		}
+		c.mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			continue
+		}
+		fmt.Fprintln(conn, "ok")
+	}
+}
+
+func (c *controlServer) names() []string {
+	names := make([]string, 0, len(c.commands))
+	for name := range c.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// close removes the socket
+func (c *controlServer) close() error {
+	return c.l.Close()
+}
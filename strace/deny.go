@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// denyRule is -deny, which makes the tracer a small dynamic sandbox: a tracee entering one of the denied
+// syscalls is killed on the spot, or has the syscall fail without running it
+type denyRule struct {
+	syscalls *syscallFilter
+	errno    syscall.Errno // 0 kills
+
+	// dryRun only reports what would have been done, to try rules out on a process that matters first
+	dryRun  bool
+	matched int
+}
+
+// the errnos -deny-with takes, the ones a program is likely to handle
+var denyErrnos = map[string]syscall.Errno{
+	"EPERM":  syscall.EPERM,
+	"EACCES": syscall.EACCES,
+	"ENOSYS": syscall.ENOSYS,
+	"EINVAL": syscall.EINVAL,
+	"ENOENT": syscall.ENOENT,
+	"EIO":    syscall.EIO,
+	"EAGAIN": syscall.EAGAIN,
+	"ENOMEM": syscall.ENOMEM,
+}
+
+func parseDeny(expr, with string, dryRun bool, groups syscallGroups) (*denyRule, error) {
+	syscalls, err := parseFilter(expr, groups)
+	if err != nil || syscalls == nil {
+		return nil, err
+	}
+	d := &denyRule{syscalls: syscalls, dryRun: dryRun}
+	if with != "kill" {
+		errno, ok := denyErrnos[strings.ToUpper(with)]
+		if !ok {
+			names := make([]string, 0, len(denyErrnos))
+			for name := range denyErrnos {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("-deny-with %q isn't kill or one of %s", with, strings.Join(names, ", "))
+		}
+		d.errno = errno
+	}
+	return d, nil
+}
+
+// enter enforces the rule on a syscall the tracee is entering, tracer can be nil for a dry run
+func (d *denyRule) enter(tracer *strace.Tracer, e strace.SyscallEvent) error {
+	if !d.syscalls.match(e.Name) {
+		return nil
+	}
+	d.matched++
+	call := fmt.Sprintf("%s(%s)", e.Name, formatArgs(e.PID, e.Name, e.Args))
+
+	verb := "denied"
+	if d.dryRun {
+		verb = "would deny"
+	}
+	if d.errno == 0 {
+		fmt.Printf(">>>%s [%d] %s, killing it\n", verb, e.PID, call)
+	} else {
+		fmt.Printf(">>>%s [%d] %s, failing it with %s\n", verb, e.PID, call, denyErrnoName(d.errno))
+	}
+
+	switch {
+	case d.dryRun:
+		return nil
+	case d.errno == 0:
+		return syscall.Kill(e.PID, syscall.SIGKILL)
+	}
+	return tracer.Fail(e.PID, d.errno)
+}
+
+// print sums up a dry run
+func (d *denyRule) print(w io.Writer) {
+	if d.dryRun {
+		fmt.Fprintf(w, ">>>dry run, %d syscalls would have been denied\n", d.matched)
+	}
+}
+
+func denyErrnoName(errno syscall.Errno) string {
+	for name, e := range denyErrnos {
+		if e == errno {
+			return name
+		}
+	}
+	return errnoName(errno)
+}
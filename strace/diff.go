@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// summary is what -summary-json records about a trace, for comparing runs later with the diff subcommand
+type summary struct {
+	Command  []string                 `json:"command"`
+	Syscalls map[string]*summaryCount `json:"syscalls"`
+}
+
+type summaryCount struct {
+	Calls  int           `json:"calls"`
+	Errors int           `json:"errors"`
+	Time   time.Duration `json:"time_ns"`
+}
+
+func newSummary(command []string) *summary {
+	return &summary{Command: command, Syscalls: map[string]*summaryCount{}}
+}
+
+func (s *summary) record(name string, d time.Duration, failed bool) {
+	c, ok := s.Syscalls[name]
+	if !ok {
+		c = &summaryCount{}
+		s.Syscalls[name] = c
+	}
+	c.Calls++
+	c.Time += d
+	if failed {
+		c.Errors++
+	}
+}
+
+func (s *summary) writeJSON(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func loadSummary(path string) (*summary, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s summary
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Syscalls == nil {
+		return nil, fmt.Errorf("%s is not a -summary-json file", path)
+	}
+	return &s, nil
+}
+
+// runDiff implements `diff [-threshold 20] old.json new.json`, comparing two -summary-json files.
+// it exits with 1 when anything differs, like diff(1), so it can gate a ci job
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 20, "only show syscalls whose count or time changed by more than this percentage")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s diff [flags] <old.json> <new.json>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	old, err := loadSummary(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cur, err := loadSummary(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if printDiff(os.Stdout, old, cur, *threshold) {
+		return 1
+	}
+	return 0
+}
+
+// printDiff prints new (+), removed (-) and changed (~) syscalls, and reports whether there were any
+func printDiff(w io.Writer, old, cur *summary, threshold float64) bool {
+	seen := map[string]bool{}
+	for name := range old.Syscalls {
+		seen[name] = true
+	}
+	for name := range cur.Syscalls {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "--- %v\n+++ %v\n", old.Command, cur.Command)
+
+	differs := false
+	for _, name := range names {
+		o, c := old.Syscalls[name], cur.Syscalls[name]
+		switch {
+		case o == nil:
+			fmt.Fprintf(w, "+ %-20s %d calls, %v (new)\n", name, c.Calls, c.Time)
+		case c == nil:
+			fmt.Fprintf(w, "- %-20s %d calls, %v (removed)\n", name, o.Calls, o.Time)
+		default:
+			calls := percentChange(float64(o.Calls), float64(c.Calls))
+			t := percentChange(float64(o.Time), float64(c.Time))
+			if math.Abs(calls) <= threshold && math.Abs(t) <= threshold {
+				continue
+			}
+			fmt.Fprintf(w, "~ %-20s %d -> %d calls (%+.0f%%), %v -> %v (%+.0f%%)\n",
+				name, o.Calls, c.Calls, calls, o.Time, c.Time, t)
+		}
+		differs = true
+	}
+	return differs
+}
+
+func percentChange(old, cur float64) float64 {
+	if old == 0 {
+		if cur == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (cur - old) / old * 100
+}
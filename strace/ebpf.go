@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	seccomp "github.com/seccomp/libseccomp-golang"
+)
+
+// -backend ebpf counts syscalls and their time in the kernel instead of stopping the tracee twice for each
+// of them: two small programs on the sys_enter and sys_exit raw tracepoints keep per syscall counters for
+// the traced thread group, and we read them once it's done. there's nothing to peek arguments with, so it's
+// the summary only, everything else needs the ptrace backend
+//
+// the programs are assembled here rather than compiled from C, so there's no clang or libbpf to depend on
+
+const (
+	sysBPF = 321 // on x86_64
+
+	bpfMapCreate         = 0
+	bpfMapLookupElem     = 1
+	bpfMapUpdateElem     = 2
+	bpfProgLoad          = 5
+	bpfRawTracepointOpen = 17
+
+	bpfMapTypeHash        = 1
+	bpfMapTypePercpuArray = 6
+	bpfProgTypeRawTP      = 17
+
+	// helpers
+	bpfMapLookup       = 1
+	bpfMapUpdate       = 2
+	bpfMapDelete       = 3
+	bpfKtimeGetNs      = 5
+	bpfGetCurrentPidTg = 14
+
+	// syscall numbers the counters have room for
+	bpfMaxSyscalls = 512
+	// a counter is calls, errors, nanoseconds
+	bpfCounterSize = 24
+)
+
+// bpfInsn is struct bpf_insn
+type bpfInsn struct {
+	code uint8
+	regs uint8 // dst in the low nibble, src in the high one
+	off  int16
+	imm  int32
+}
+
+func insn(code, dst, src uint8, off int16, imm int32) bpfInsn {
+	return bpfInsn{code, dst | src<<4, off, imm}
+}
+
+// the few instructions the programs need
+func movReg(dst, src uint8) bpfInsn           { return insn(0xbf, dst, src, 0, 0) }
+func movImm(dst uint8, imm int32) bpfInsn     { return insn(0xb7, dst, 0, 0, imm) }
+func addImm(dst uint8, imm int32) bpfInsn     { return insn(0x07, dst, 0, 0, imm) }
+func addReg(dst, src uint8) bpfInsn           { return insn(0x0f, dst, src, 0, 0) }
+func subReg(dst, src uint8) bpfInsn           { return insn(0x1f, dst, src, 0, 0) }
+func rshImm(dst uint8, imm int32) bpfInsn     { return insn(0x77, dst, 0, 0, imm) }
+func ldxDW(dst, src uint8, off int16) bpfInsn { return insn(0x79, dst, src, off, 0) }
+func stxDW(dst, src uint8, off int16) bpfInsn { return insn(0x7b, dst, src, off, 0) }
+func stxW(dst, src uint8, off int16) bpfInsn  { return insn(0x63, dst, src, off, 0) }
+func call(helper int32) bpfInsn               { return insn(0x85, 0, 0, 0, helper) }
+func exit() bpfInsn                           { return insn(0x95, 0, 0, 0, 0) }
+
+// jumps are relative to the next instruction
+func jeqImm(dst uint8, imm int32, off int16) bpfInsn  { return insn(0x15, dst, 0, off, imm) }
+func jgtImm(dst uint8, imm int32, off int16) bpfInsn  { return insn(0x25, dst, 0, off, imm) }
+func jsgeImm(dst uint8, imm int32, off int16) bpfInsn { return insn(0x75, dst, 0, off, imm) }
+func jsltImm(dst uint8, imm int32, off int16) bpfInsn { return insn(0xc5, dst, 0, off, imm) }
+
+// ldMap loads a map's fd into dst, it's a two instruction load the kernel turns into the map's address
+func ldMap(dst uint8, fd int) []bpfInsn {
+	return []bpfInsn{insn(0x18, dst, 1, 0, int32(fd)), {}}
+}
+
+// enterProgram remembers the syscall and when it started for every thread of a traced thread group
+//
+//	if targets[tgid] { start[tid] = {nr, now} }
+func enterProgram(targets, start int) []bpfInsn {
+	var p []bpfInsn
+	p = append(p,
+		movReg(6, 1), // the context: args[0] is the registers, args[1] the syscall number
+		call(bpfGetCurrentPidTg),
+		movReg(7, 0),
+		rshImm(0, 32),
+		stxW(10, 0, -4),
+		movReg(2, 10),
+		addImm(2, -4),
+	)
+	p = append(p, ldMap(1, targets)...)
+	p = append(p,
+		call(bpfMapLookup),
+		jeqImm(0, 0, 13),
+		ldxDW(1, 6, 8),
+		stxDW(10, 1, -24),
+		call(bpfKtimeGetNs),
+		stxDW(10, 0, -16),
+		stxW(10, 7, -4),
+		movReg(2, 10),
+		addImm(2, -4),
+		movReg(3, 10),
+		addImm(3, -24),
+	)
+	p = append(p, ldMap(1, start)...)
+	p = append(p,
+		movImm(4, 0),
+		call(bpfMapUpdate),
+		movImm(0, 0),
+		exit(),
+	)
+	return p
+}
+
+// exitProgram adds up the syscall a thread that was seen entering it just returned from
+//
+//	if s := start[tid] { c := counters[s.nr]; c.calls++; c.errors += failed; c.ns += now - s.ts; delete start[tid] }
+func exitProgram(start, counters int) []bpfInsn {
+	var p []bpfInsn
+	p = append(p,
+		movReg(6, 1), // the context: args[0] is the registers, args[1] the return value
+		call(bpfGetCurrentPidTg),
+		movReg(7, 0),
+		stxW(10, 7, -4),
+		movReg(2, 10),
+		addImm(2, -4),
+	)
+	p = append(p, ldMap(1, start)...)
+	p = append(p,
+		call(bpfMapLookup),
+		jeqImm(0, 0, 32),
+		movReg(8, 0),
+		call(bpfKtimeGetNs),
+		ldxDW(1, 8, 8),
+		subReg(0, 1),
+		movReg(9, 0),
+		ldxDW(1, 8, 0),
+		jgtImm(1, bpfMaxSyscalls-1, 19),
+		stxW(10, 1, -8),
+		movReg(2, 10),
+		addImm(2, -8),
+	)
+	p = append(p, ldMap(1, counters)...)
+	p = append(p,
+		call(bpfMapLookup),
+		jeqImm(0, 0, 12),
+		ldxDW(1, 0, 0),
+		addImm(1, 1),
+		stxDW(0, 1, 0),
+		ldxDW(1, 0, 16),
+		addReg(1, 9),
+		stxDW(0, 1, 16),
+		ldxDW(1, 6, 8),
+		jsgeImm(1, 0, 4),
+		jsltImm(1, -4095, 3),
+		ldxDW(1, 0, 8),
+		addImm(1, 1),
+		stxDW(0, 1, 8),
+		stxW(10, 7, -4),
+		movReg(2, 10),
+		addImm(2, -4),
+	)
+	p = append(p, ldMap(1, start)...)
+	p = append(p,
+		call(bpfMapDelete),
+		movImm(0, 0),
+		exit(),
+	)
+	return p
+}
+
+func bpf(cmd int, attr []byte) (int, error) {
+	fd, _, errno := syscall.Syscall(sysBPF, uintptr(cmd), uintptr(unsafe.Pointer(&attr[0])), uintptr(len(attr)))
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func bpfCreateMap(typ, keySize, valueSize, entries uint32) (int, error) {
+	attr := make([]byte, 72)
+	binary.LittleEndian.PutUint32(attr, typ)
+	binary.LittleEndian.PutUint32(attr[4:], keySize)
+	binary.LittleEndian.PutUint32(attr[8:], valueSize)
+	binary.LittleEndian.PutUint32(attr[12:], entries)
+	return bpf(bpfMapCreate, attr)
+}
+
+// bpfMapElem looks up or updates the element at key
+func bpfMapElem(cmd, fd int, key, value []byte) error {
+	attr := make([]byte, 32)
+	binary.LittleEndian.PutUint32(attr, uint32(fd))
+	binary.LittleEndian.PutUint64(attr[8:], uint64(uintptr(unsafe.Pointer(&key[0]))))
+	binary.LittleEndian.PutUint64(attr[16:], uint64(uintptr(unsafe.Pointer(&value[0]))))
+	_, err := bpf(cmd, attr)
+	// the kernel has the pointers in attr, the gc doesn't know
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+func bpfLoad(prog []bpfInsn) (int, error) {
+	license := []byte("GPL\x00")
+	log := make([]byte, 64*1024)
+	attr := make([]byte, 128)
+	binary.LittleEndian.PutUint32(attr, bpfProgTypeRawTP)
+	binary.LittleEndian.PutUint32(attr[4:], uint32(len(prog)))
+	binary.LittleEndian.PutUint64(attr[8:], uint64(uintptr(unsafe.Pointer(&prog[0]))))
+	binary.LittleEndian.PutUint64(attr[16:], uint64(uintptr(unsafe.Pointer(&license[0]))))
+	binary.LittleEndian.PutUint32(attr[24:], 1) // log level, only filled in when the verifier says no
+	binary.LittleEndian.PutUint32(attr[28:], uint32(len(log)))
+	binary.LittleEndian.PutUint64(attr[32:], uint64(uintptr(unsafe.Pointer(&log[0]))))
+	fd, err := bpf(bpfProgLoad, attr)
+	runtime.KeepAlive(prog)
+	runtime.KeepAlive(license)
+	if err != nil {
+		if n := strings.IndexByte(string(log), 0); n > 0 {
+			return -1, fmt.Errorf("%w:\n%s", err, log[:n])
+		}
+		return -1, err
+	}
+	return fd, nil
+}
+
+func bpfAttach(tracepoint string, prog int) (int, error) {
+	name := []byte(tracepoint + "\x00")
+	attr := make([]byte, 16)
+	binary.LittleEndian.PutUint64(attr, uint64(uintptr(unsafe.Pointer(&name[0]))))
+	binary.LittleEndian.PutUint32(attr[8:], uint32(prog))
+	fd, err := bpf(bpfRawTracepointOpen, attr)
+	runtime.KeepAlive(name)
+	return fd, err
+}
+
+// ebpfCounters are the maps and attached programs of an eBPF trace, closing them detaches it
+type ebpfCounters struct {
+	targets, counters int
+	fds               []int
+}
+
+func newEBPFCounters() (*ebpfCounters, error) {
+	c := &ebpfCounters{}
+	var err error
+	if c.targets, err = bpfCreateMap(bpfMapTypeHash, 4, 4, 64); err != nil {
+		return nil, fmt.Errorf("creating bpf map: %w", err)
+	}
+	start, err := bpfCreateMap(bpfMapTypeHash, 4, 16, 16384)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("creating bpf map: %w", err)
+	}
+	c.fds = append(c.fds, c.targets, start)
+	if c.counters, err = bpfCreateMap(bpfMapTypePercpuArray, 4, bpfCounterSize, bpfMaxSyscalls); err != nil {
+		c.close()
+		return nil, fmt.Errorf("creating bpf map: %w", err)
+	}
+	c.fds = append(c.fds, c.counters)
+
+	for _, tp := range []struct {
+		name string
+		prog []bpfInsn
+	}{
+		{"sys_enter", enterProgram(c.targets, start)},
+		{"sys_exit", exitProgram(start, c.counters)},
+	} {
+		prog, err := bpfLoad(tp.prog)
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("loading the %s program: %w", tp.name, err)
+		}
+		c.fds = append(c.fds, prog)
+		link, err := bpfAttach(tp.name, prog)
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("attaching to %s: %w", tp.name, err)
+		}
+		c.fds = append(c.fds, link)
+	}
+	return c, nil
+}
+
+func (c *ebpfCounters) close() {
+	for _, fd := range c.fds {
+		syscall.Close(fd)
+	}
+}
+
+// trace starts counting the syscalls of every thread of tgid
+func (c *ebpfCounters) trace(tgid int) error {
+	key := make([]byte, 4)
+	binary.LittleEndian.PutUint32(key, uint32(tgid))
+	return bpfMapElem(bpfMapUpdateElem, c.targets, key, make([]byte, 4))
+}
+
+// read sums the per cpu counters up, by syscall number
+func (c *ebpfCounters) read() (map[int]benchCount, map[int]int, error) {
+	cpus, err := possibleCPUs()
+	if err != nil {
+		return nil, nil, err
+	}
+	counts, errors := map[int]benchCount{}, map[int]int{}
+	key := make([]byte, 4)
+	value := make([]byte, bpfCounterSize*cpus)
+	for nr := 0; nr < bpfMaxSyscalls; nr++ {
+		binary.LittleEndian.PutUint32(key, uint32(nr))
+		if err := bpfMapElem(bpfMapLookupElem, c.counters, key, value); err != nil {
+			return nil, nil, err
+		}
+		var total benchCount
+		for cpu := 0; cpu < cpus; cpu++ {
+			v := value[cpu*bpfCounterSize:]
+			total.calls += int(binary.LittleEndian.Uint64(v))
+			errors[nr] += int(binary.LittleEndian.Uint64(v[8:]))
+			total.time += time.Duration(binary.LittleEndian.Uint64(v[16:]))
+		}
+		if total.calls > 0 {
+			counts[nr] = total
+		}
+	}
+	return counts, errors, nil
+}
+
+// possibleCPUs is how many cpus per cpu maps have values for, from a list like 0-7
+func possibleCPUs() (int, error) {
+	b, err := os.ReadFile("/sys/devices/system/cpu/possible")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range strings.Split(strings.TrimSpace(string(b)), ",") {
+		lo, hi, found := strings.Cut(r, "-")
+		if !found {
+			hi = lo
+		}
+		l, err1 := strconv.Atoi(lo)
+		h, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil {
+			return 0, fmt.Errorf("bad cpu list %q", b)
+		}
+		n += h - l + 1
+	}
+	return n, nil
+}
+
+// ebpfFlags are the flags the eBPF backend goes with, everything else needs to see the syscalls one by one
+var ebpfFlags = map[string]bool{"backend": true, "e": true, "groups": true, "p": true}
+
+// runEBPF traces a command, or the process -p attaches to, with the eBPF backend and prints the summary
+func runEBPF(args []string, pid int, filter *syscallFilter) int {
+	var bad []string
+	flag.Visit(func(f *flag.Flag) {
+		if !ebpfFlags[f.Name] {
+			bad = append(bad, "-"+f.Name)
+		}
+	})
+	if len(bad) > 0 {
+		fmt.Fprintf(os.Stderr, "%s need the ptrace backend, -backend ebpf only counts\n", strings.Join(bad, ", "))
+		return 2
+	}
+
+	c, err := newEBPFCounters()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-backend ebpf:", err)
+		return 1
+	}
+	defer c.close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	status := -1
+	if pid != 0 {
+		if err := c.trace(pid); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf(">>>counting the syscalls of %d (%s)\n", pid, procName(pid))
+		// it isn't our child to wait for, so check on it until it's gone or we're interrupted
+		ticker := time.NewTicker(100 * time.Millisecond)
+	wait:
+		for {
+			select {
+			case <-sigs:
+				fmt.Printf(">>>detached from %d\n", pid)
+				break wait
+			case <-ticker.C:
+				if syscall.Kill(pid, 0) == syscall.ESRCH {
+					fmt.Printf(">>>%d exited\n", pid)
+					break wait
+				}
+			}
+		}
+		ticker.Stop()
+	} else {
+		fmt.Printf(">>>running %s with args %s\n", args[0], args[1:])
+		if status, err = runEBPFCommand(c, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf(">>>done, exit status %d\n", status)
+	}
+
+	counts, errors, err := c.read()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading the bpf counters:", err)
+		return 1
+	}
+	printEBPF(os.Stdout, counts, errors, filter)
+	if status < 0 {
+		return 0
+	}
+	return status
+}
+
+// runEBPFCommand starts the command through ebpf-child, which waits for us to add its pid to the traced
+// ones before it execs the command, so nothing from the command's start is missed
+func runEBPFCommand(c *ebpfCounters, args []string) (int, error) {
+	// looked up here so the child doesn't stat its way through $PATH while it's counted
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return 0, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command("/proc/self/exe", append([]string{"ebpf-child", path}, args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{r, readyW}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	r.Close()
+	readyW.Close()
+	// the go runtime of the child starts up before it says it's ready, that isn't counted
+	var b [1]byte
+	readyR.Read(b[:])
+	readyR.Close()
+	err = c.trace(cmd.Process.Pid)
+	w.Close()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return 0, err
+	}
+
+	// an interrupt goes to the command too, we wait for it to exit
+	cmd.Wait()
+	return exitCode(cmd.ProcessState.Sys().(syscall.WaitStatus)), nil
+}
+
+// ebpfChild is the start of a command traced with -backend ebpf, args are its path and argv. it says it's ready
+// on fd 4, waits for the pipe on fd 3 to be closed, then becomes the command. the read of the pipe and the exec
+// are counted with the command, and whatever the go runtime's other threads do meanwhile
+func ebpfChild(args []string) {
+	syscall.CloseOnExec(3)
+	syscall.CloseOnExec(4)
+	syscall.Write(4, []byte{0})
+	var b [1]byte
+	syscall.Read(3, b[:])
+	err := syscall.Exec(args[0], args[1:], os.Environ())
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(126)
+}
+
+func printEBPF(w io.Writer, counts map[int]benchCount, errors map[int]int, filter *syscallFilter) {
+	type row struct {
+		name string
+		benchCount
+		errors int
+	}
+	var rows []row
+	for nr, c := range counts {
+		name, err := seccomp.ScmpSyscall(nr).GetName()
+		if err != nil {
+			name = fmt.Sprintf("syscall_%d", nr)
+		}
+		if filter.match(name) {
+			rows = append(rows, row{name, c, errors[nr]})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].time > rows[j].time })
+
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s -> %v \n", r.name, r.calls)
+	}
+	fmt.Fprintln(w, ">>>syscall time")
+	fmt.Fprintf(w, "%-20s %10s %10s %14s %12s\n", "SYSCALL", "CALLS", "ERRORS", "TIME", "AVG")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%-20s %10d %10d %14v %12v\n", r.name, r.calls, r.errors, r.time, r.time/time.Duration(r.calls))
+	}
+}
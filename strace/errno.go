@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// errnoNames are the errno constants by number, the same on every linux arch but mips, alpha and sparc
+var errnoNames = map[syscall.Errno]string{
+	1: "EPERM", 2: "ENOENT", 3: "ESRCH", 4: "EINTR", 5: "EIO", 6: "ENXIO", 7: "E2BIG", 8: "ENOEXEC",
+	9: "EBADF", 10: "ECHILD", 11: "EAGAIN", 12: "ENOMEM", 13: "EACCES", 14: "EFAULT", 16: "EBUSY",
+	17: "EEXIST", 18: "EXDEV", 19: "ENODEV", 20: "ENOTDIR", 21: "EISDIR", 22: "EINVAL", 23: "ENFILE",
+	24: "EMFILE", 25: "ENOTTY", 26: "ETXTBSY", 27: "EFBIG", 28: "ENOSPC", 29: "ESPIPE", 30: "EROFS",
+	31: "EMLINK", 32: "EPIPE", 34: "ERANGE", 35: "EDEADLK", 36: "ENAMETOOLONG", 38: "ENOSYS",
+	39: "ENOTEMPTY", 40: "ELOOP", 61: "ENODATA", 62: "ETIME", 75: "EOVERFLOW", 88: "ENOTSOCK",
+	95: "EOPNOTSUPP", 97: "EAFNOSUPPORT", 98: "EADDRINUSE", 99: "EADDRNOTAVAIL", 101: "ENETUNREACH",
+	103: "ECONNABORTED", 104: "ECONNRESET", 105: "ENOBUFS", 106: "EISCONN", 107: "ENOTCONN",
+	110: "ETIMEDOUT", 111: "ECONNREFUSED", 113: "EHOSTUNREACH", 114: "EALREADY", 115: "EINPROGRESS",
+	125: "ECANCELED",
+	// what the kernel returns for a syscall interrupted by a signal, restarted before the tracee sees it
+	512: "ERESTARTSYS", 513: "ERESTARTNOINTR", 514: "ERESTARTNOHAND", 516: "ERESTART_RESTARTBLOCK",
+}
+
+func errnoName(errno syscall.Errno) string {
+	if name, ok := errnoNames[errno]; ok {
+		return name
+	}
+	return fmt.Sprintf("errno %d", int(errno))
+}
+
+// errorSummary counts the failed syscalls by errno, and which syscalls failed with it
+type errorSummary map[syscall.Errno]map[string]int
+
+func (s errorSummary) record(name string, ret int64) {
+	if ret >= 0 || ret <= -4096 {
+		return
+	}
+	errno := syscall.Errno(-ret)
+	if s[errno] == nil {
+		s[errno] = map[string]int{}
+	}
+	s[errno][name]++
+}
+
+func (s errorSummary) print(w io.Writer) {
+	if len(s) == 0 {
+		return
+	}
+	totals := map[syscall.Errno]int{}
+	errnos := make([]syscall.Errno, 0, len(s))
+	for errno, calls := range s {
+		for _, n := range calls {
+			totals[errno] += n
+		}
+		errnos = append(errnos, errno)
+	}
+	sort.Slice(errnos, func(i, j int) bool { return totals[errnos[i]] > totals[errnos[j]] })
+
+	fmt.Fprintln(w, ">>>errors by errno")
+	for _, errno := range errnos {
+		names := make([]string, 0, len(s[errno]))
+		for name := range s[errno] {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return s[errno][names[i]] > s[errno][names[j]] })
+		from := make([]string, len(names))
+		for i, name := range names {
+			from[i] = fmt.Sprintf("%s %d", name, s[errno][name])
+		}
+		fmt.Fprintf(w, "%s -> %d (%s)\n", errnoName(errno), totals[errno], strings.Join(from, ", "))
+	}
+}
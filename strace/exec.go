@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// execLog is -execs: every program a tracee (or with -f one of its children) executes, with its argv and
+// with -exec-env its environment, so chains like shell -> python -> subprocess can be followed. the syscalls
+// each program made are counted until it's replaced, and start over from 0 for the new one
+type execLog struct {
+	env     bool
+	pending map[int]execCall // read on entry, the tracee's memory is gone once the exec succeeded
+	calls   map[int]int      // syscalls of the program each pid is running
+	progs   map[int]string
+}
+
+type execCall struct {
+	path       string
+	argv, envp []string
+	prev       string // the program being replaced
+}
+
+const (
+	// how many argv and envp entries are read
+	execMaxArgs = 256
+	execMaxArg  = 4096
+)
+
+func newExecLog(env bool) *execLog {
+	return &execLog{env: env, pending: map[int]execCall{}, calls: map[int]int{}, progs: map[int]string{}}
+}
+
+func (x *execLog) enter(pid int, name string, args [6]uint64) {
+	var path, argv, envp uint64
+	switch name {
+	case "execve":
+		path, argv, envp = args[0], args[1], args[2]
+	case "execveat":
+		path, argv, envp = args[1], args[2], args[3]
+	default:
+		return
+	}
+	c := execCall{argv: peekStrings(pid, argv), prev: x.progs[pid]}
+	if c.prev == "" {
+		// the main tracee or a forked child, running what it was started with or inherited
+		c.prev = procName(pid)
+	}
+	c.path, _ = strace.PeekString(pid, uintptr(path), execMaxArg)
+	if x.env {
+		c.envp = peekStrings(pid, envp)
+	}
+	x.pending[pid] = c
+}
+
+// count adds a traced syscall to the program pid is running
+func (x *execLog) count(pid int) {
+	x.calls[pid]++
+}
+
+func (x *execLog) exit(w io.Writer, pid int, name string, ret int64) {
+	c, ok := x.pending[pid]
+	if !ok || (name != "execve" && name != "execveat") {
+		return
+	}
+	delete(x.pending, pid)
+	if ret != 0 {
+		return
+	}
+
+	quoted := make([]string, len(c.argv))
+	for i, arg := range c.argv {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+	// the exec itself belongs to the old program
+	fmt.Fprintf(w, ">>>exec [%d] %s [%s], %s made %d syscalls\n", pid, c.path, strings.Join(quoted, ", "), c.prev, x.calls[pid])
+	for _, kv := range c.envp {
+		fmt.Fprintf(w, "    %s\n", kv)
+	}
+	x.progs[pid] = c.path
+	x.calls[pid] = 0
+}
+
+// peekStrings reads a NULL terminated array of string pointers, like argv
+func peekStrings(pid int, addr uint64) []string {
+	var s []string
+	for i := 0; addr != 0 && i < execMaxArgs; i++ {
+		b, err := strace.PeekData(pid, uintptr(addr)+uintptr(8*i), 8)
+		if err != nil || len(b) < 8 {
+			break
+		}
+		p := binary.LittleEndian.Uint64(b)
+		if p == 0 {
+			break
+		}
+		arg, err := strace.PeekString(pid, uintptr(p), execMaxArg)
+		if err != nil {
+			break
+		}
+		s = append(s, arg)
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// flagArgs are the arguments rendered symbolically instead of in hex, by syscall and argument index
+var flagArgs = map[string]map[int]func(uint64) string{
+	"open":     {1: describeOpenFlags, 2: describeMode},
+	"openat":   {2: describeOpenFlags, 3: describeMode},
+	"creat":    {1: describeMode},
+	"mkdir":    {1: describeMode},
+	"mkdirat":  {2: describeMode},
+	"chmod":    {1: describeMode},
+	"fchmod":   {1: describeMode},
+	"fchmodat": {2: describeMode},
+	"mmap":     {2: describeProt, 3: describeMmapFlags},
+	"mprotect": {2: describeProt},
+	"clone":    {0: describeCloneFlags},
+}
+
+// statArgs are where the stat calls write their struct, which only means something once they returned
+var statArgs = map[string]struct {
+	arg      int
+	describe func(pid int, addr uint64) (string, bool)
+}{
+	"stat": {1, describeStat}, "lstat": {1, describeStat}, "fstat": {1, describeStat},
+	"newfstatat": {2, describeStat}, "statx": {4, describeStatx},
+}
+
+func describeOpenFlags(v uint64) string {
+	access := fmt.Sprintf("%#x", v&3)
+	if mode := v & 3; mode < uint64(len(openAccess)) {
+		access = openAccess[mode]
+	}
+	if rest := uint32(v &^ 3); rest != 0 {
+		return access + "|" + describeFlags(openFlags, rest)
+	}
+	return access
+}
+
+// describeMode renders permissions in octal, with the file type in front when there is one
+func describeMode(v uint64) string {
+	mode := uint32(v)
+	if typ, ok := fileTypes[mode&syscall.S_IFMT]; ok {
+		return fmt.Sprintf("%s|%#o", typ, mode&^syscall.S_IFMT)
+	}
+	return fmt.Sprintf("%#o", mode)
+}
+
+func describeProt(v uint64) string {
+	if v == 0 {
+		return "PROT_NONE"
+	}
+	return describeFlags(mmapProt, uint32(v))
+}
+
+func describeMmapFlags(v uint64) string {
+	typ, ok := mmapTypes[uint32(v&0xf)]
+	if !ok {
+		typ = fmt.Sprintf("%#x", v&0xf)
+	}
+	if rest := uint32(v &^ 0xf); rest != 0 {
+		return typ + "|" + describeFlags(mmapFlags, rest)
+	}
+	return typ
+}
+
+func describeCloneFlags(v uint64) string {
+	s := ""
+	if rest := uint32(v &^ 0xff); rest != 0 {
+		s = describeFlags(cloneFlags, rest)
+	}
+	if sig := syscall.Signal(v & 0xff); sig != 0 {
+		if s != "" {
+			s += "|"
+		}
+		name, ok := exitSignals[sig]
+		if !ok {
+			name = fmt.Sprint(int(sig))
+		}
+		s += name
+	}
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// the signals a clone can ask for on exit, it's SIGCHLD nearly always
+var exitSignals = map[syscall.Signal]string{
+	syscall.SIGCHLD: "SIGCHLD", syscall.SIGUSR1: "SIGUSR1", syscall.SIGUSR2: "SIGUSR2", syscall.SIGTERM: "SIGTERM",
+}
+
+// describeStat reads back the struct stat a successful stat call filled in, the fields worth seeing of it
+func describeStat(pid int, addr uint64) (string, bool) {
+	b, err := strace.PeekData(pid, uintptr(addr), statSize)
+	if err != nil || len(b) < statSize {
+		return "", false
+	}
+	return fmt.Sprintf("{st_mode=%s, st_uid=%d, st_gid=%d, st_size=%d}",
+		describeMode(uint64(binary.LittleEndian.Uint32(b[statMode:]))),
+		binary.LittleEndian.Uint32(b[statUID:]), binary.LittleEndian.Uint32(b[statGID:]),
+		int64(binary.LittleEndian.Uint64(b[statSizeAt:]))), true
+}
+
+func describeStatx(pid int, addr uint64) (string, bool) {
+	b, err := strace.PeekData(pid, uintptr(addr), statxSize)
+	if err != nil || len(b) < statxSize {
+		return "", false
+	}
+	return fmt.Sprintf("{stx_mode=%s, stx_uid=%d, stx_gid=%d, stx_size=%d}",
+		describeMode(uint64(binary.LittleEndian.Uint16(b[statxMode:]))),
+		binary.LittleEndian.Uint32(b[statxUID:]), binary.LittleEndian.Uint32(b[statxGID:]),
+		binary.LittleEndian.Uint64(b[statxSizeAt:])), true
+}
@@ -0,0 +1,60 @@
+package main
+
+// the constants behind the symbolic arguments, as x86_64 has them. most are the same everywhere but not
+// all: O_DIRECTORY and friends differ on arm64, and struct stat is laid out differently on every arch
+
+var openAccess = []string{"O_RDONLY", "O_WRONLY", "O_RDWR"}
+
+// O_SYNC and O_TMPFILE are O_DSYNC and O_DIRECTORY with another bit, and come before them
+var openFlags = []flagName{
+	{0x40, "O_CREAT"}, {0x80, "O_EXCL"}, {0x100, "O_NOCTTY"}, {0x200, "O_TRUNC"}, {0x400, "O_APPEND"},
+	{0x800, "O_NONBLOCK"}, {0x101000, "O_SYNC"}, {0x1000, "O_DSYNC"}, {0x2000, "O_ASYNC"}, {0x4000, "O_DIRECT"},
+	{0x8000, "O_LARGEFILE"}, {0x410000, "O_TMPFILE"}, {0x10000, "O_DIRECTORY"}, {0x20000, "O_NOFOLLOW"},
+	{0x40000, "O_NOATIME"}, {0x80000, "O_CLOEXEC"}, {0x200000, "O_PATH"},
+}
+
+var mmapProt = []flagName{
+	{0x1, "PROT_READ"}, {0x2, "PROT_WRITE"}, {0x4, "PROT_EXEC"}, {0x8, "PROT_SEM"},
+	{0x1000000, "PROT_GROWSDOWN"}, {0x2000000, "PROT_GROWSUP"},
+}
+
+// mmapTypes is the low nibble of the mmap flags, one of these and never several
+var mmapTypes = map[uint32]string{0x1: "MAP_SHARED", 0x2: "MAP_PRIVATE", 0x3: "MAP_SHARED_VALIDATE"}
+
+var mmapFlags = []flagName{
+	{0x10, "MAP_FIXED"}, {0x20, "MAP_ANONYMOUS"}, {0x40, "MAP_32BIT"}, {0x100, "MAP_GROWSDOWN"},
+	{0x800, "MAP_DENYWRITE"}, {0x1000, "MAP_EXECUTABLE"}, {0x2000, "MAP_LOCKED"}, {0x4000, "MAP_NORESERVE"},
+	{0x8000, "MAP_POPULATE"}, {0x10000, "MAP_NONBLOCK"}, {0x20000, "MAP_STACK"}, {0x40000, "MAP_HUGETLB"},
+	{0x80000, "MAP_SYNC"}, {0x100000, "MAP_FIXED_NOREPLACE"},
+}
+
+// the low byte of the clone flags is the signal sent to the parent on exit
+var cloneFlags = []flagName{
+	{0x100, "CLONE_VM"}, {0x200, "CLONE_FS"}, {0x400, "CLONE_FILES"}, {0x800, "CLONE_SIGHAND"},
+	{0x1000, "CLONE_PIDFD"}, {0x2000, "CLONE_PTRACE"}, {0x4000, "CLONE_VFORK"}, {0x8000, "CLONE_PARENT"},
+	{0x10000, "CLONE_THREAD"}, {0x20000, "CLONE_NEWNS"}, {0x40000, "CLONE_SYSVSEM"}, {0x80000, "CLONE_SETTLS"},
+	{0x100000, "CLONE_PARENT_SETTID"}, {0x200000, "CLONE_CHILD_CLEARTID"}, {0x400000, "CLONE_DETACHED"},
+	{0x800000, "CLONE_UNTRACED"}, {0x1000000, "CLONE_CHILD_SETTID"}, {0x2000000, "CLONE_NEWCGROUP"},
+	{0x4000000, "CLONE_NEWUTS"}, {0x8000000, "CLONE_NEWIPC"}, {0x10000000, "CLONE_NEWUSER"},
+	{0x20000000, "CLONE_NEWPID"}, {0x40000000, "CLONE_NEWNET"}, {0x80000000, "CLONE_IO"},
+}
+
+var fileTypes = map[uint32]string{
+	0140000: "S_IFSOCK", 0120000: "S_IFLNK", 0100000: "S_IFREG", 060000: "S_IFBLK",
+	040000: "S_IFDIR", 020000: "S_IFCHR", 010000: "S_IFIFO",
+}
+
+// where the fields we show are in struct stat and struct statx
+const (
+	statSize   = 144
+	statMode   = 24 // uint32
+	statUID    = 28
+	statGID    = 32
+	statSizeAt = 48 // int64
+
+	statxSize   = 256
+	statxUID    = 20 // uint32
+	statxGID    = 24
+	statxMode   = 28 // uint16
+	statxSizeAt = 40 // uint64
+)
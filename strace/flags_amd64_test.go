@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestDescribeOpenFlags(t *testing.T) {
+	for _, tt := range []struct {
+		flags uint64
+		want  string
+	}{
+		{0x0, "O_RDONLY"},
+		{0x10000, "O_RDONLY|O_DIRECTORY"},
+		{0x90800, "O_RDONLY|O_NONBLOCK|O_DIRECTORY|O_CLOEXEC"},
+		{0x1001, "O_WRONLY|O_DSYNC"},
+		{0x101001, "O_WRONLY|O_SYNC"},
+		{0x410002, "O_RDWR|O_TMPFILE"},
+		{0x410042, "O_RDWR|O_CREAT|O_TMPFILE"},
+		{0x100000, "O_RDONLY|0x100000"},
+	} {
+		if got := describeOpenFlags(tt.flags); got != tt.want {
+			t.Errorf("describeOpenFlags(%#x) = %s, want %s", tt.flags, got, tt.want)
+		}
+	}
+}
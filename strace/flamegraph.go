@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// foldedStacks aggregates syscall time per stack in the folded format of
+// https://github.com/brendangregg/FlameGraph, one "frame;frame;frame value" line per stack,
+// for `flamegraph.pl --countname ns out.folded > out.svg` or https://www.speedscope.app.
+// stacks are the process name and the syscall for now, with the user stack in between once we can unwind it
+type foldedStacks struct {
+	time  map[string]time.Duration
+	comms map[int]string // process names by pid, so /proc isn't read for every syscall
+}
+
+func newFoldedStacks() *foldedStacks {
+	return &foldedStacks{time: map[string]time.Duration{}, comms: map[int]string{}}
+}
+
+func (f *foldedStacks) add(pid int, name string, d time.Duration) {
+	comm, ok := f.comms[pid]
+	if !ok {
+		comm = procName(pid)
+		f.comms[pid] = comm
+	}
+	// ; separates frames and spaces separate the value, so neither can be in a frame
+	comm = strings.NewReplacer(";", "_", " ", "_").Replace(comm)
+	f.time[comm+";"+name] += d
+}
+
+// write writes the stacks sorted, with the time in nanoseconds
+func (f *foldedStacks) write(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+
+	stacks := make([]string, 0, len(f.time))
+	for stack := range f.time {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		fmt.Fprintf(w, "%s %d\n", stack, f.time[stack].Nanoseconds())
+	}
+
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
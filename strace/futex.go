@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// futexTracker decodes futex calls and adds them up by futex word, which is how lock contention shows up
+// to a tracer: a contended mutex or condition variable is a futex that threads keep waiting on. words are
+// per address space, so threads of one process share them and they're keyed by thread group
+type futexTracker struct {
+	words map[futexKey]*futexWord
+	tgids threadGroups
+}
+
+type futexKey struct {
+	tgid int
+	addr uint64
+}
+
+type futexWord struct {
+	waits    int
+	waited   time.Duration
+	longest  time.Duration
+	timeouts int // waits that gave up
+	retries  int // waits that didn't sleep because the value had already changed (EAGAIN)
+	wakes    int
+	woken    int // waiters the wakes woke up
+}
+
+const (
+	futexPrivate       = 128
+	futexClockRealtime = 256
+
+	// the most contended words printed in the summary
+	futexTop = 20
+)
+
+var futexOps = []string{
+	"WAIT", "WAKE", "FD", "REQUEUE", "CMP_REQUEUE", "WAKE_OP", "LOCK_PI", "UNLOCK_PI", "TRYLOCK_PI",
+	"WAIT_BITSET", "WAKE_BITSET", "WAIT_REQUEUE_PI", "CMP_REQUEUE_PI", "LOCK_PI2",
+}
+
+func newFutexTracker() *futexTracker {
+	return &futexTracker{words: map[futexKey]*futexWord{}, tgids: threadGroups{}}
+}
+
+func futexOpName(op uint64) string {
+	cmd := op &^ (futexPrivate | futexClockRealtime)
+	name := fmt.Sprintf("OP_%d", cmd)
+	if cmd < uint64(len(futexOps)) {
+		name = futexOps[cmd]
+	}
+	if op&futexPrivate != 0 {
+		name += "_PRIVATE"
+	}
+	return "FUTEX_" + name
+}
+
+// exit records a futex call that just returned, given its entry args, and returns it decoded
+func (f *futexTracker) exit(pid int, args [6]uint64, ret int64, d time.Duration) string {
+	tgid := f.tgids.of(pid)
+	w, ok := f.words[futexKey{tgid, args[0]}]
+	if !ok {
+		w = &futexWord{}
+		f.words[futexKey{tgid, args[0]}] = w
+	}
+
+	line := fmt.Sprintf("futex(%#x, %s, %d) = %d <%v>", args[0], futexOpName(args[1]), int32(args[2]), ret, d)
+	switch cmd := args[1] &^ (futexPrivate | futexClockRealtime); cmd {
+	case 0, 6, 9, 11, 13: // the waits, and taking a pi lock
+		switch syscall.Errno(-ret) {
+		case syscall.EAGAIN:
+			w.retries++
+			line += " value changed"
+			return line
+		case syscall.ETIMEDOUT:
+			w.timeouts++
+			line += " timed out"
+		}
+		w.waits++
+		w.waited += d
+		if d > w.longest {
+			w.longest = d
+		}
+	case 1, 3, 4, 5, 7, 10, 12: // the wakes
+		w.wakes++
+		if ret > 0 {
+			w.woken += int(ret)
+		}
+	}
+	return line
+}
+
+// print lists the futex words waited on for longest
+func (f *futexTracker) print(w io.Writer) {
+	keys := make([]futexKey, 0, len(f.words))
+	for k, word := range f.words {
+		if word.waits > 0 || word.retries > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return f.words[keys[i]].waited > f.words[keys[j]].waited
+	})
+	if len(keys) > futexTop {
+		keys = keys[:futexTop]
+	}
+
+	fmt.Fprintln(w, ">>>futex contention")
+	for _, k := range keys {
+		word := f.words[k]
+		fmt.Fprintf(w, "%#x pid %d -> %d waits %v (longest %v), %d timeouts, %d retries, %d wakes woke %d \n",
+			k.addr, k.tgid, word.waits, word.waited, word.longest, word.timeouts, word.retries, word.wakes, word.woken)
+	}
+}
+
+// threadGroups remembers which process each thread belongs to, the syscall decoders that key things by
+// address space or fd table look it up on every call
+type threadGroups map[int]int
+
+func (g threadGroups) of(tid int) int {
+	tgid, ok := g[tid]
+	if !ok {
+		tgid = procTgid(tid)
+		g[tid] = tgid
+	}
+	return tgid
+}
+
+// procTgid is the process a thread belongs to, tid itself if that can't be read
+func procTgid(tid int) int {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return tid
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "Tgid:") {
+			if tgid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Tgid:"))); err == nil {
+				return tgid
+			}
+		}
+	}
+	return tid
+}
@@ -2,4 +2,7 @@ module github.com/hpdobrica/go-playground/strace
 
 go 1.18
 
-require github.com/seccomp/libseccomp-golang v0.10.0 // indirect
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/seccomp/libseccomp-golang v0.10.0
+)
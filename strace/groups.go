@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	seccomp "github.com/seccomp/libseccomp-golang"
+)
+
+// syscallGroups are user defined named sets of syscalls, loaded from a json file like
+//
+//	{"db-io": ["pread64", "pwrite64", "fsync", "fdatasync"]}
+type syscallGroups map[string][]string
+
+func loadGroups(path string) (syscallGroups, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups syscallGroups
+	if err := json.Unmarshal(b, &groups); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for group, names := range groups {
+		for _, name := range names {
+			if _, err := seccomp.GetSyscallFromName(name); err != nil {
+				return nil, fmt.Errorf("group %s: unknown syscall %q", group, name)
+			}
+		}
+	}
+	return groups, nil
+}
+
+func (g syscallGroups) names() []string {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// print adds a row per group to the summary, with the counts of its members
+func (g syscallGroups) print(w io.Writer, counts map[string]int) {
+	for _, group := range g.names() {
+		total := 0
+		var members []string
+		for _, name := range g[group] {
+			if counts[name] > 0 {
+				total += counts[name]
+				members = append(members, fmt.Sprintf("%s %d", name, counts[name]))
+			}
+		}
+		fmt.Fprintf(w, "%%%s -> %v (%s)\n", group, total, strings.Join(members, ", "))
+	}
+}
+
+// syscallFilter decides which syscalls are traced, a nil filter traces everything
+type syscallFilter struct {
+	names map[string]bool
+}
+
+// parseFilter parses a comma separated list of syscall and group names, eg "openat,close,%db-io".
+// groups can be referenced with or without the leading %
+func parseFilter(expr string, groups syscallGroups) (*syscallFilter, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	f := &syscallFilter{names: map[string]bool{}}
+	for _, name := range strings.Split(expr, ",") {
+		name = strings.TrimSpace(name)
+		if members, ok := groups[strings.TrimPrefix(name, "%")]; ok {
+			for _, member := range members {
+				f.names[member] = true
+			}
+			continue
+		}
+		if _, err := seccomp.GetSyscallFromName(name); err != nil {
+			return nil, fmt.Errorf("unknown syscall or group %q", name)
+		}
+		f.names[name] = true
+	}
+	return f, nil
+}
+
+func (f *syscallFilter) match(name string) bool {
+	return f == nil || f.names[name]
+}
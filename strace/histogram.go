@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencies keeps a duration histogram per syscall, all sharing the same buckets
+type latencies struct {
+	bounds []time.Duration // bucket upper bounds, anything slower lands in an extra overflow bucket
+	hists  map[string]*histogram
+}
+
+type histogram struct {
+	Counts []int         `json:"counts"`
+	Count  int           `json:"count"`
+	Total  time.Duration `json:"total_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+// parseBuckets parses a comma separated list of durations, eg "10us,100us,1ms"
+func parseBuckets(s string) ([]time.Duration, error) {
+	var bounds []time.Duration
+	for _, b := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(b))
+		if err != nil {
+			return nil, fmt.Errorf("bad histogram bucket %q: %w", b, err)
+		}
+		if len(bounds) > 0 && d <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("histogram buckets must be increasing, got %s after %s", d, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, d)
+	}
+	return bounds, nil
+}
+
+func newLatencies(bounds []time.Duration) *latencies {
+	return &latencies{bounds: bounds, hists: map[string]*histogram{}}
+}
+
+func (l *latencies) record(name string, d time.Duration) {
+	h, ok := l.hists[name]
+	if !ok {
+		h = &histogram{Counts: make([]int, len(l.bounds)+1)}
+		l.hists[name] = h
+	}
+
+	i := sort.Search(len(l.bounds), func(i int) bool { return d <= l.bounds[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Total += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+func (l *latencies) names() []string {
+	names := make([]string, 0, len(l.hists))
+	for name := range l.hists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *latencies) print(w io.Writer) {
+	const barWidth = 40
+
+	for _, name := range l.names() {
+		h := l.hists[name]
+		fmt.Fprintf(w, "%s (count %d, avg %v, max %v)\n", name, h.Count, h.Total/time.Duration(h.Count), h.Max)
+
+		for i, c := range h.Counts {
+			label := "> " + l.bounds[len(l.bounds)-1].String()
+			if i < len(l.bounds) {
+				label = "<= " + l.bounds[i].String()
+			}
+			fmt.Fprintf(w, "  %10s %8d %s\n", label, c, strings.Repeat("#", (c*barWidth+h.Count-1)/h.Count))
+		}
+	}
+}
+
+func (l *latencies) writeJSON(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bounds := make([]int64, len(l.bounds))
+	for i, b := range l.bounds {
+		bounds[i] = int64(b)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Bounds   []int64               `json:"bucket_bounds_ns"`
+		Syscalls map[string]*histogram `json:"syscalls"`
+	}{bounds, l.hists})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// intervalSummary prints the syscall counts every interval, for watching long running daemons change over time
+type intervalSummary struct {
+	mu         sync.Mutex
+	counts     map[string]int
+	cumulative bool // keep counting across intervals instead of resetting after each print
+	stopped    chan struct{}
+	done       chan struct{}
+}
+
+func newIntervalSummary(cumulative bool) *intervalSummary {
+	return &intervalSummary{
+		counts:     map[string]int{},
+		cumulative: cumulative,
+		stopped:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *intervalSummary) record(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[name]++
+}
+
+// run prints to w every interval until stop is called
+func (s *intervalSummary) run(w io.Writer, interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	from := start
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case now := <-ticker.C:
+			fmt.Fprintf(w, ">>>interval %v-%v\n", from.Sub(start).Round(time.Second), now.Sub(start).Round(time.Second))
+			s.print(w)
+			if !s.cumulative {
+				from = now
+			}
+		}
+	}
+}
+
+func (s *intervalSummary) stop() {
+	close(s.stopped)
+	<-s.done
+}
+
+func (s *intervalSummary) print(w io.Writer) {
+	s.mu.Lock()
+	counts := s.counts
+	if !s.cumulative {
+		s.counts = map[string]int{}
+	} else {
+		counts = make(map[string]int, len(s.counts))
+		for k, v := range s.counts {
+			counts[k] = v
+		}
+	}
+	s.mu.Unlock()
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%s -> %v \n", name, counts[name])
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ioctlNames names the common ioctl requests, -ioctls adds to it from a json file like
+//
+//	{"0xc0406400": "DRM_IOCTL_VERSION", "0x5401": "TCGETS"}
+var ioctlNames = map[uint32]string{
+	0x5401: "TCGETS", 0x5402: "TCSETS", 0x5403: "TCSETSW", 0x5404: "TCSETSF",
+	0x540e: "TIOCSCTTY", 0x540f: "TIOCGPGRP", 0x5410: "TIOCSPGRP", 0x5413: "TIOCGWINSZ", 0x5414: "TIOCSWINSZ",
+	0x541b: "FIONREAD", 0x5421: "FIONBIO", 0x5422: "TIOCNOTTY", 0x5450: "FIONCLEX", 0x5451: "FIOCLEX",
+	0x5452: "FIOASYNC", 0x80045430: "TIOCGPTN", 0x40045431: "TIOCSPTLCK",
+	0x8913: "SIOCGIFFLAGS", 0x8914: "SIOCSIFFLAGS", 0x8927: "SIOCGIFHWADDR", 0x8933: "SIOCGIFINDEX",
+	0x80081272: "BLKGETSIZE64", 0x40049409: "FICLONE", 0xc020660b: "FS_IOC_FIEMAP",
+	0xae00: "KVM_GET_API_VERSION", 0xae01: "KVM_CREATE_VM", 0xae41: "KVM_CREATE_VCPU", 0xae80: "KVM_RUN",
+	0xc0406400: "DRM_IOCTL_VERSION",
+}
+
+// ioctlTypes name the subsystems of requests that aren't in ioctlNames, by the type byte of _IOC
+var ioctlTypes = map[uint32]string{
+	'd': "DRM", 0xae: "KVM", 'T': "TTY", 'f': "FS", 'V': "VIDIOC", 'U': "USBDEVFS", 0x12: "BLK", 0x94: "BTRFS",
+}
+
+var ioctlDirs = []string{"_IO", "_IOW", "_IOR", "_IOWR"}
+
+func loadIoctls(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var names map[string]string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for request, name := range names {
+		n, err := strconv.ParseUint(request, 0, 32)
+		if err != nil {
+			return fmt.Errorf("%s: bad ioctl request %q", path, request)
+		}
+		ioctlNames[uint32(n)] = name
+	}
+	return nil
+}
+
+// describeIoctl names an ioctl request, or takes it apart into its _IOC fields: direction,
+// type (the subsystem), number and argument size
+func describeIoctl(request uint64) string {
+	r := uint32(request)
+	if name, ok := ioctlNames[r]; ok {
+		return name
+	}
+	dir, size, typ, nr := r>>30, (r>>16)&0x3fff, (r>>8)&0xff, r&0xff
+	if dir == 0 && size == 0 && typ == 0 {
+		return fmt.Sprintf("%#x", request)
+	}
+	subsystem, ok := ioctlTypes[typ]
+	if !ok {
+		subsystem = strconv.QuoteRune(rune(typ))
+		if typ < ' ' || typ > '~' {
+			subsystem = fmt.Sprintf("%#x", typ)
+		}
+	}
+	if dir == 0 {
+		return fmt.Sprintf("%s(%s, %#x)", ioctlDirs[dir], subsystem, nr)
+	}
+	return fmt.Sprintf("%s(%s, %#x, %d)", ioctlDirs[dir], subsystem, nr, size)
+}
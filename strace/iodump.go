@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ioDumpFilter is the -dump-io fds and files, the data read from or written to them is hexdumped after
+// the call, like strace's -e read= and -e write=
+type ioDumpFilter struct {
+	fds   map[int]bool
+	paths pathFilter
+}
+
+func (d *ioDumpFilter) String() string {
+	var s []string
+	for fd := range d.fds {
+		s = append(s, strconv.Itoa(fd))
+	}
+	return strings.Join(append(s, d.paths...), ",")
+}
+
+// Set takes an fd number, or a file, or a directory for the files under it, as the tracee sees them
+func (d *ioDumpFilter) Set(v string) error {
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return d.paths.Set(v)
+	}
+	if fd < 0 {
+		return fmt.Errorf("-dump-io %d isn't an fd", fd)
+	}
+	if d.fds == nil {
+		d.fds = map[int]bool{}
+	}
+	d.fds[fd] = true
+	return nil
+}
+
+// dump hexdumps the data of a read/write style syscall that just returned, if its fd is one of the filter's
+func (d *ioDumpFilter) dump(w io.Writer, pid int, name string, args [6]uint64, ret int64) {
+	if _, ok := ioSyscalls[name]; !ok || ret <= 0 || (d.fds == nil && d.paths == nil) {
+		return
+	}
+	fd := int(int32(args[0]))
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+	if err == nil {
+		link = traceeView(traceeRoot(pid), link)
+	}
+	if !d.fds[fd] && (link == "" || !d.paths.under(link)) {
+		return
+	}
+
+	data, err := ioBuffer(pid, name, args, ret)
+	if err != nil && !(peekFault(err) && len(data) > 0) {
+		return
+	}
+	fmt.Fprintf(w, "%s%s fd %d %s, %d bytes\n", pidColumn(pid), paint(colorName, name), fd, link, len(data))
+	for _, line := range strings.Split(strings.TrimSuffix(hex.Dump(data), "\n"), "\n") {
+		fmt.Fprintf(w, "%s| %s\n", pidColumn(pid), line)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// libTracker attributes syscalls to the mapped object they were made from, by where the tracee was when it
+// made them: libc for most programs, but it shows a libssl or a plugin being the busy one. the code of a
+// process is looked up in its /proc/pid/maps, read again whenever an address isn't in it or the mappings changed
+type libTracker struct {
+	tgids threadGroups
+	maps  map[int][]codeMapping // by thread group, nil until read
+	libs  map[string]*libCalls
+}
+
+// codeMapping is an executable mapping
+type codeMapping struct {
+	start, end uint64
+	object     string
+}
+
+type libCalls struct {
+	calls    int
+	syscalls map[string]int
+}
+
+// how many of each object's top syscalls are printed
+const libTopSyscalls = 3
+
+func newLibTracker() *libTracker {
+	return &libTracker{tgids: threadGroups{}, maps: map[int][]codeMapping{}, libs: map[string]*libCalls{}}
+}
+
+// enter counts a syscall made from ip
+func (l *libTracker) enter(pid int, name string, ip uint64) {
+	tgid := l.tgids.of(pid)
+	object, ok := findMapping(l.maps[tgid], ip)
+	if !ok {
+		l.maps[tgid] = readCodeMappings(tgid)
+		if object, ok = findMapping(l.maps[tgid], ip); !ok {
+			object = "?"
+		}
+	}
+	c, ok := l.libs[object]
+	if !ok {
+		c = &libCalls{syscalls: map[string]int{}}
+		l.libs[object] = c
+	}
+	c.calls++
+	c.syscalls[name]++
+}
+
+// exit drops the mappings of a process once they changed, so they're read again
+func (l *libTracker) exit(pid int, name string, ret int64) {
+	if ret < 0 && ret > -4096 {
+		return
+	}
+	switch name {
+	case "mmap", "munmap", "mprotect", "mremap", "execve", "execveat":
+		delete(l.maps, l.tgids.of(pid))
+	}
+}
+
+func findMapping(maps []codeMapping, ip uint64) (string, bool) {
+	i := sort.Search(len(maps), func(i int) bool { return maps[i].end > ip })
+	if i < len(maps) && maps[i].start <= ip {
+		return maps[i].object, true
+	}
+	return "", false
+}
+
+// readCodeMappings reads the executable mappings of a process, sorted by address, named by the file they
+// map or what the kernel calls them, like [vdso]
+func readCodeMappings(pid int) []codeMapping {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var maps []codeMapping
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 7f2c1a400000-7f2c1a595000 r-xp 00028000 08:01 1234 /usr/lib/x86_64-linux-gnu/libc.so.6
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+		end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		object := "[anonymous]"
+		if len(fields) > 5 {
+			object = filepath.Base(strings.Join(fields[5:], " "))
+		}
+		maps = append(maps, codeMapping{start, end, object})
+	}
+	sort.Slice(maps, func(i, j int) bool { return maps[i].start < maps[j].start })
+	return maps
+}
+
+func (l *libTracker) print(w io.Writer) {
+	fmt.Fprintln(w, ">>>syscalls by library")
+	objects := make([]string, 0, len(l.libs))
+	for object := range l.libs {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return l.libs[objects[i]].calls > l.libs[objects[j]].calls })
+	for _, object := range objects {
+		c := l.libs[object]
+		names := make([]string, 0, len(c.syscalls))
+		for name := range c.syscalls {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return c.syscalls[names[i]] > c.syscalls[names[j]] })
+		if len(names) > libTopSyscalls {
+			names = names[:libTopSyscalls]
+		}
+		top := make([]string, len(names))
+		for i, name := range names {
+			top[i] = fmt.Sprintf("%s %d", name, c.syscalls[name])
+		}
+		fmt.Fprintf(w, "%s -> %d (%s)\n", object, c.calls, strings.Join(top, ", "))
+	}
+}
@@ -1,63 +1,844 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
-	"syscall"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
-	seccomp "github.com/seccomp/libseccomp-golang"
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
 )
 
+var (
+	attachPid         = flag.Int("p", 0, "attach to this running process instead of starting a command")
+	follow            = flag.Bool("f", false, "trace child processes and threads too, and print the process tree with their syscall totals")
+	mergeTree         = flag.Bool("tree-merge", false, "with -f, fold sibling processes running the same command into one row of the tree")
+	chromeTracePath   = flag.String("chrome-trace", "", "write syscalls to this file as chrome trace-event json (about://tracing, perfetto)")
+	printHistogram    = flag.Bool("histogram", false, "print a latency histogram per syscall")
+	histogramBuckets  = flag.String("histogram-buckets", "1us,10us,100us,1ms,10ms,100ms,1s", "comma separated upper bounds of the histogram buckets")
+	histogramJSONPath = flag.String("histogram-json", "", "write the latency histograms to this file as json")
+	ioctlsPath        = flag.String("ioctls", "", "json file naming more ioctl requests, eg {\"0x5401\": \"TCGETS\"}")
+	groupsPath        = flag.String("groups", "", "json file defining named syscall groups, eg {\"db-io\": [\"pread64\", \"fsync\"]}")
+	filterExpr        = flag.String("e", "", "only trace these comma separated syscalls or %groups")
+	interval          = flag.Duration("interval", 0, "print the syscall counts every interval, eg 10s")
+	cumulative        = flag.Bool("cumulative", false, "keep counting across -interval prints instead of resetting")
+	unixPeers         = flag.Bool("unix-peers", false, "print connect/sendto/sendmsg calls on unix sockets with the peer path and pid")
+	pcapPath          = flag.String("pcap", "", "write data read from and written to tcp/udp sockets to this pcapng file")
+	flamegraphPath    = flag.String("flamegraph", "", "write syscall time per process and syscall to this file as folded stacks, for flamegraph.pl")
+	summaryJSONPath   = flag.String("summary-json", "", "write per syscall calls, errors and time to this file, to compare runs with the diff subcommand")
+	otlpEndpoint      = flag.String("otlp", "", "export syscalls as spans to this OTLP/HTTP collector, eg http://localhost:4318")
+	otlpWindow        = flag.Duration("otlp-window", 0, "export one span per syscall per window with counts, instead of a span per call")
+	traceparent       = flag.String("traceparent", os.Getenv("TRACEPARENT"), "W3C traceparent to export spans under (defaults to $TRACEPARENT)")
+	failedOnly        = flag.Bool("failed-only", false, "print every syscall that returns an error as soon as it returns, the summary still counts them all")
+	grepExpr          = flag.String("grep", "", "print every syscall whose rendered line matches this regexp, eg 'openat.*\\.so', or only those of -failed-only and -slower-than")
+	slowerThan        = flag.Duration("slower-than", 0, "print every syscall that takes longer than this as soon as it returns, eg 50ms")
+	maxSyscalls       = flag.Int("max-syscalls", 0, "detach and print the summary after this many traced syscalls")
+	maxDuration       = flag.Duration("duration", 0, "detach and print the summary after tracing for this long")
+	killAfter         = flag.Duration("kill-after", 0, "kill the command (and with -f its children) after this long, and print the summary")
+	sqlitePath        = flag.String("sqlite", "", "write every syscall to a syscalls table in this sqlite database")
+	recordPath        = flag.String("record", "", "record every syscall to this trace file, to look at again later with the replay subcommand")
+	showUring         = flag.Bool("io-uring", false, "print every io_uring submission queue entry as it's submitted (they're always counted in the summary)")
+	futexMode         = flag.Bool("futex", false, "decode every futex call and print the most contended futex words, by time spent waiting on them")
+	stdoutPath        = flag.String("stdout", "", "write the command's stdout to this file instead of between the trace output")
+	stderrPath        = flag.String("stderr", "", "write the command's stderr to this file instead of between the trace output")
+	annotateOutput    = flag.Bool("annotate-output", false, "keep the command's stdout and stderr inline, but start each of their lines with >>>stdout: or >>>stderr:")
+	memoryMode        = flag.Bool("memory", false, "follow mmap, munmap, mremap and brk, and print the peak and total mapped size with a timeline of the address space")
+	showReadiness     = flag.Bool("readiness", false, "decode epoll, poll and inotify calls: which fds were watched for what, and which events fired")
+	denyExpr          = flag.String("deny", "", "comma separated syscalls or %groups the command isn't allowed to make, eg ptrace,execve")
+	denyWith          = flag.String("deny-with", "kill", "what happens to a -deny syscall: kill the process, or fail the syscall with an errno like EPERM")
+	dryRun            = flag.Bool("dry-run", false, "print what -deny would do without doing it, also works with replay")
+	sampleExpr        = flag.String("sample", "", "only trace this fraction of the time, eg 1/100 or 0.01, in 10ms windows, for less overhead on busy programs")
+	noColor           = flag.Bool("no-color", false, "don't color the live trace lines, even on a terminal")
+	chdir             = flag.String("chdir", "", "start the command in this directory")
+	runAsUID          = flag.Int("uid", -1, "start the command as this user id, needs root")
+	runAsGID          = flag.Int("gid", -1, "start the command as this group id, needs root")
+	showExecs         = flag.Bool("execs", false, "print every program executed with its argv, and how many syscalls the program it replaced made")
+	showExecEnv       = flag.Bool("exec-env", false, "with -execs, print the environment of every executed program too")
+	showLibs          = flag.Bool("libs", false, "count syscalls by the library or binary that made them, from where the tracee was in /proc/pid/maps")
+	repeat            = flag.Int("repeat", 0, "run the command this many times and print the mean and stddev of every syscall's count and time, only -e applies")
+	showMeter         = flag.Bool("meter", false, "keep a status line on stderr with the syscalls per second and the top 3 syscalls over the last second")
+	showSecurity      = flag.Bool("security", false, "decode prctl, seccomp, capset, rlimit and set*id calls, and point out the ones that drop privileges or sandbox the process")
+	hostPaths         = flag.Bool("host-paths", false, "print where the paths a tracee in a container or chroot uses are on the host, next to the path it sees")
+	backend           = flag.String("backend", "ptrace", "ptrace, or ebpf to only count syscalls and their time, of all the threads but not the children, with next to no overhead and no ptrace")
+	learnPath         = flag.String("learn", "", "add the sequences of -ngram syscalls every thread makes to this file, a baseline for -baseline, several runs can go into one")
+	baselinePath      = flag.String("baseline", "", "point out the syscall sequences a -learn file doesn't have, as they happen and in the summary")
+	ngram             = flag.Int("ngram", 3, "how many syscalls in a row make a sequence for -learn, -baseline uses the length it was learned with")
+	seccompPath       = flag.String("emit-seccomp", "", "write an OCI seccomp profile to this file that allows exactly the syscalls the command made, for docker run --security-opt seccomp=")
+	startAfter        = flag.Duration("start-after", 0, "let the command run untraced this long before attaching to it, to skip its startup; with -p, wait this long")
+	stringLimit       = flag.Int("s", 32, "how many bytes of read and written data to print, paths are printed whole; 0 reads no strings or buffers from the tracee, their addresses are printed")
+	benchmark         = flag.Bool("benchmark", false, "run the command untraced and traced, and print how much slower tracing makes it, -repeat times")
+	controlPath       = flag.String("control", "", "take commands on this unix socket while tracing: pause, resume, set-filter <-e expression>, dump-summary, detach")
+	sortBy            = flag.String("sort", "", "order the summary by count, time, avg or errors, and print those with every syscall")
+	summaryLimit      = flag.Int("limit", 0, "only print this many syscalls of the summary, the first ones by -sort, which defaults to count then")
+	collapseRepeats   = flag.Bool("collapse", false, "fold a call, or a sequence of up to 4, printed over and over into one '... repeated n times' line")
+	subreaper         = flag.Bool("subreaper", false, "with -f, reparent the command's orphans, like a daemon that double forked, to strace instead of init")
+	showTop           = flag.Bool("top", false, "show a live table of syscall rates, error rates and time while the command runs")
+
+	paths       pathFilter
+	env         envVars
+	threadNames threadNameFilter
+	decoders    plugins
+	dumpIO      ioDumpFilter
+)
+
+func init() {
+	flag.Var(&paths, "path", "only trace syscalls on files under this path, as the tracee sees it in a container, can be repeated")
+	flag.Var(&env, "env", "set KEY=VAL in the command's environment, can be repeated")
+	flag.DurationVar(maxDuration, "trace-for", 0, "the same as -duration, with -start-after the window is traced for this long and then detached from")
+	flag.Var(&decoders, "plugin", "load a go plugin that registers syscall or ioctl decoders with strace.RegisterDecoder, can be repeated")
+	flag.Var(&dumpIO, "dump-io", "hexdump the data read from or written to this fd, or file or directory as the tracee sees it, can be repeated")
+	flag.Var(&threadNames, "thread-name", "only trace the threads whose name matches this glob, eg 'worker*', can be repeated")
+}
+
 func main() {
-	fmt.Printf(">>>running %s with args %s\n", os.Args[1], os.Args[2:])
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+	if len(os.Args) > 3 && os.Args[1] == "ebpf-child" {
+		ebpfChild(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "multi" {
+		os.Exit(runMulti(os.Args[2:]))
+	}
 
-	syscallCounter := map[string]int{}
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <cmd> [args...]\n       %s [flags] -p <pid>\n       %s replay [flags] <trace file>\n       %s bench [flags] -- <cmdA> [args...] -- <cmdB> [args...]\n       %s diff [flags] <old.json> <new.json>\n       %s multi [flags] [-cmd \"<cmd>\"]... [-p <pid>]...\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
 
-	cmd := exec.Command(os.Args[1], os.Args[2:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Ptrace: true,
+	// replay takes the same flags, but reads the syscalls from a -record file instead of a tracee
+	var replaying *traceReader
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := replayableFlags(); err != nil {
+			log.Fatal(err)
+		}
+		tr, f, err := openTrace(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		replaying = tr
+	} else {
+		flag.Parse()
+		if (flag.NArg() == 0) == (*attachPid == 0) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *attachPid != 0 && commandFlagsSet() {
+			log.Fatal("-stdout, -stderr, -annotate-output, -env, -chdir, -uid and -gid need a command to run, an attached process is already running")
+		}
 	}
+	args := flag.Args()
 
-	cmd.Run()
-	pid := cmd.Process.Pid
+	if *ioctlsPath != "" {
+		if err := loadIoctls(*ioctlsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	stage := "enter"
+	var groups syscallGroups
+	if *groupsPath != "" {
+		var err error
+		groups, err = loadGroups(*groupsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	filter, err := parseFilter(*filterExpr, groups)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	for {
+	switch *backend {
+	case "ptrace":
+	case "ebpf":
+		if replaying != nil {
+			log.Fatal("-backend ebpf traces a live process, replay has the recorded syscalls already")
+		}
+		os.Exit(runEBPF(args, *attachPid, filter))
+	default:
+		log.Fatalf("-backend %q isn't ptrace or ebpf", *backend)
+	}
 
-		var regs syscall.PtraceRegs
-		err := syscall.PtraceGetRegs(pid, &regs)
+	if *benchmark {
+		if replaying != nil || *attachPid != 0 {
+			log.Fatal("-benchmark needs a command it can start, not -p or replay")
+		}
+		reps := *repeat
+		if reps < 1 {
+			reps = 1
+		}
+		os.Exit(overheadCommand(args, *follow, reps))
+	}
 
+	if *repeat > 0 {
+		if replaying != nil || *attachPid != 0 {
+			log.Fatal("-repeat needs a command it can start again, not -p or replay")
+		}
+		os.Exit(repeatCommand(args, filter, *repeat))
+	}
+
+	deny, err := parseDeny(*denyExpr, *denyWith, *dryRun, groups)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sample, err := parseSample(*sampleExpr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := decoders.load(); err != nil {
+		log.Fatal(err)
+	}
+	if *stringLimit < 0 {
+		log.Fatal("-s can't be negative")
+	}
+
+	colorOutput = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+
+	var grep *regexp.Regexp
+	if *grepExpr != "" {
+		if grep, err = regexp.Compile(*grepExpr); err != nil {
+			log.Fatalf("-grep: %v", err)
+		}
+	}
+
+	var lat *latencies
+	if *printHistogram || *histogramJSONPath != "" {
+		bounds, err := parseBuckets(*histogramBuckets)
 		if err != nil {
-			if err.Error() == "no such process" {
-				break
-			} else {
+			log.Fatal(err)
+		}
+		lat = newLatencies(bounds)
+	}
+
+	if *summaryLimit > 0 && *sortBy == "" {
+		*sortBy = "count"
+	}
+	if err := checkSummaryOrder(*sortBy); err != nil {
+		log.Fatal(err)
+	}
+	var sorted *summary // time and errors of every syscall for -sort
+	if *sortBy != "" {
+		sorted = newSummary(nil)
+	}
+
+	syscallCounter := map[string]int{}
+	errnos := errorSummary{}
+
+	// printCounts starts the summary, it's also what dump-summary on the -control socket prints
+	printCounts := func(w io.Writer) {
+		if sorted != nil {
+			printSorted(w, syscallCounter, sorted, *sortBy, *summaryLimit)
+		} else {
+			for k, v := range syscallCounter {
+				fmt.Fprintf(w, "%s -> %v \n", k, v)
+			}
+		}
+		groups.print(w, syscallCounter)
+		errnos.print(w)
+	}
+
+	var trace *chromeTrace
+	if *chromeTracePath != "" {
+		trace = newChromeTrace(replaying == nil)
+	}
+
+	var folded *foldedStacks
+	if *flamegraphPath != "" {
+		folded = newFoldedStacks()
+	}
+
+	var sum *summary
+	if *summaryJSONPath != "" {
+		sum = newSummary(tracedCommand(args, replaying))
+	}
+
+	var profile *seccompProfile
+	if *seccompPath != "" {
+		profile = newSeccompProfile()
+	}
+
+	var rec *recorder
+	if *recordPath != "" {
+		var err error
+		if rec, err = newRecorder(*recordPath, tracedCommand(args, replaying)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var db *sqliteExport
+	if *sqlitePath != "" {
+		var err error
+		if db, err = newSQLiteExport(*sqlitePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var pcap *pcapWriter
+	if *pcapPath != "" {
+		var err error
+		if pcap, err = newPcapWriter(*pcapPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var otlp *otlpExporter
+	if *otlpEndpoint != "" {
+		var err error
+		if otlp, err = newOTLPExporter(*otlpEndpoint, *traceparent, *otlpWindow); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var live *topTable
+	if *showTop || *showMeter {
+		live = newTopTable(*showMeter)
+		go live.run(os.Stderr, time.Second)
+	}
+
+	var periodic *intervalSummary
+	if *interval > 0 {
+		periodic = newIntervalSummary(*cumulative)
+		go periodic.run(os.Stdout, *interval)
+	}
+
+	// the syscall each tracee is in, entries and exits of different tracees interleave with -f
+	type inFlight struct {
+		enter  strace.SyscallEvent
+		traced bool   // passed the filters, decided on entry
+		args   string // formatted on entry for -sqlite, while the paths can still be read
+	}
+	inFlights := map[int]*inFlight{}
+	uring := newUringTracker()
+
+	var memory *memoryTracker
+	if *memoryMode {
+		memory = newMemoryTracker()
+	}
+
+	var readiness *readinessDecoder
+	if *showReadiness {
+		readiness = newReadinessDecoder()
+	}
+
+	var execs *execLog
+	if *showExecs {
+		execs = newExecLog(*showExecEnv)
+	}
+
+	var futexes *futexTracker
+	if *futexMode {
+		futexes = newFutexTracker()
+	}
+
+	var libs *libTracker
+	if *showLibs {
+		libs = newLibTracker()
+	}
+
+	var collapse *collapser
+	if *collapseRepeats {
+		collapse = newCollapser()
+	}
+
+	var sequences *sequenceTracker
+	if *learnPath != "" || *baselinePath != "" {
+		if *ngram < 1 {
+			log.Fatal("-ngram has to be at least 1")
+		}
+		sequences = newSequenceTracker(*ngram)
+		if *baselinePath != "" {
+			if err := sequences.compareTo(*baselinePath); err != nil {
 				log.Fatal(err)
 			}
 		}
+		if *learnPath != "" {
+			if err := sequences.learnInto(*learnPath); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var tree *procTree
+	if *follow {
+		tree = newProcTree()
+	}
 
-		regName, _ := seccomp.ScmpSyscall(regs.Orig_rax).GetName() // no-lib alternative would be to create a arch-dependent map[code]name
+	var stop func() // ends the trace early, detaching from a tracee or stopping a replay
+	seen := 0
 
-		if stage == "enter" {
-			stage = "exit"
+	// handle gets every syscall event, live or replayed, with the paths it touches on entry if -path or -record need them
+	var tracer *strace.Tracer
+	handle := func(e strace.SyscallEvent, touched []string) {
+		if e.Stage == strace.Enter {
+			if deny != nil {
+				if err := deny.enter(tracer, e); err != nil {
+					log.Printf("denying %s to %d: %v", e.Name, e.PID, err)
+				}
+			}
+			f := &inFlight{enter: e}
+			inFlights[e.PID] = f
+			// rings are tracked whatever the filters say, otherwise -e io_uring_enter would decode nothing
+			for _, sqe := range uring.enter(e.PID, e.Name, e.Args) {
+				if *showUring {
+					fmt.Printf("%s%s %s\n", pidColumn(e.PID), paint(colorName, "io_uring"), sqe)
+				}
+			}
+			if execs != nil {
+				execs.enter(e.PID, e.Name, e.Args)
+			}
+			if profile != nil {
+				profile.enter(e.Name)
+			}
+
+			f.traced = filter.match(e.Name) && paths.match(touched) && threadNames.match(e.PID)
+			if !f.traced {
+				return
+			}
+			if db != nil {
+				f.args = formatArgs(e.PID, e.Name, e.Args)
+			}
+			syscallCounter[e.Name] += 1
+			if tree != nil {
+				tree.enter(e.PID, e.Time)
+			}
+			if execs != nil {
+				execs.count(e.PID)
+			}
+			if libs != nil {
+				libs.enter(e.PID, e.Name, e.IP)
+			}
+			if sequences != nil {
+				if seq, first := sequences.enter(e.PID, e.Name); first {
+					fmt.Printf("%s%s %s\n", pidColumn(e.PID), paint(colorSecurity, "new sequence"), seq)
+				}
+			}
+			if periodic != nil {
+				periodic.record(e.Name)
+			}
+			if seen++; seen == *maxSyscalls {
+				fmt.Printf(">>>reached %d syscalls\n", seen)
+				stop()
+			}
+			return
+		}
+		f, ok := inFlights[e.PID]
+		if !ok {
+			return
+		}
+		delete(inFlights, e.PID)
+		enter := f.enter
+		uring.exit(e.PID, e.Name, enter.Args, e.RetVal)
+		if execs != nil {
+			execs.exit(os.Stdout, e.PID, e.Name, e.RetVal)
+		}
+		if memory != nil {
+			memory.exit(e.PID, e.Name, enter.Args, e.RetVal, e.Time)
+		}
+		if libs != nil {
+			libs.exit(e.PID, e.Name, e.RetVal)
+		}
+		threadNames.exit(e.PID, e.Name, enter.Args, e.RetVal)
+		if readiness != nil {
+			if line, ok := readiness.exit(e.PID, e.Name, enter.Args, e.RetVal); ok {
+				fmt.Printf("%s%s\n", pidColumn(e.PID), line)
+			}
+		}
+		if *showSecurity {
+			if line, reason, ok := describeSecurity(e.PID, e.Name, enter.Args, e.RetVal); ok {
+				if reason != "" {
+					line += paint(colorSecurity, "  <- "+reason)
+				}
+				fmt.Printf("%s%s\n", pidColumn(e.PID), line)
+			}
+		}
+		if futexes != nil && e.Name == "futex" {
+			fmt.Printf("%s%s\n", pidColumn(e.PID), futexes.exit(e.PID, enter.Args, e.RetVal, e.Duration))
+		}
+		if !f.traced {
+			return
+		}
+
+		errnos.record(e.Name, e.RetVal)
+		if tree != nil {
+			tree.exit(e.PID, e.Duration, e.Time)
+		}
+		if trace != nil {
+			trace.add(e.PID, e.Name, enter.Time, e.Time)
+		}
+		if lat != nil {
+			lat.record(e.Name, e.Duration)
+		}
+		if live != nil {
+			live.record(e.Name, e.Duration, e.Failed())
+		}
+		if folded != nil {
+			folded.add(e.PID, e.Name, e.Duration)
+		}
+		if sum != nil {
+			sum.record(e.Name, e.Duration, e.Failed())
+		}
+		if sorted != nil {
+			sorted.record(e.Name, e.Duration, e.Failed())
+		}
+		if db != nil {
+			db.add(e.PID, e.Name, f.args, enter.Time, e.RetVal, e.Duration)
+		}
+		if otlp != nil {
+			otlp.syscall(e.PID, e.Name, enter.Time, e.Time, e.RetVal, e.Failed())
+		}
+		if pcap != nil {
+			if captured, ok := captureSocketIO(e.PID, e.Name, enter.Args, e.RetVal); ok {
+				pcap.write(e.Time, captured.src, captured.dst, captured.tcp, captured.data, fmt.Sprintf("pid %d %s", e.PID, e.Name))
+			}
+		}
+		dumpIO.dump(os.Stdout, e.PID, e.Name, enter.Args, e.RetVal)
+		// -grep on its own prints every match, with -failed-only or -slower-than it narrows what they print
+		failed := *failedOnly && e.Failed()
+		slow := *slowerThan > 0 && e.Duration > *slowerThan
+		if failed || slow || (grep != nil && !*failedOnly && *slowerThan == 0) {
+			call := describeCall(e.PID, e.Name, enter.Args, e.RetVal, e.Duration)
+			if grep == nil || grep.MatchString(call.String()) {
+				line := call.render()
+				if slow {
+					line = paint(colorSlow, "slow") + " " + line
+				}
+				lines := []string{line}
+				if collapse != nil {
+					var bytes int64
+					if _, ok := ioSyscalls[e.Name]; ok && e.RetVal > 0 {
+						bytes = e.RetVal
+					}
+					lines = collapse.lines(e.PID, newCallKey(e.Name, enter.Args, e.RetVal), line, bytes, e.Duration)
+				}
+				for _, line := range lines {
+					fmt.Printf("%s%s\n", pidColumn(e.PID), line)
+				}
+			}
+		}
+		if *unixPeers {
+			if line, ok := describeUnixPeer(e.PID, e.Name, enter.Args, e.RetVal); ok {
+				fmt.Println(line)
+			}
+		}
+	}
+
+	var control *controlServer
+	onSyscall := func(e strace.SyscallEvent) {
+		if control != nil {
+			control.mu.Lock()
+			defer control.mu.Unlock()
+		}
+		var touched []string
+		if e.Stage == strace.Enter && (paths != nil || rec != nil) {
+			touched = touchedPaths(e.PID, e.Name, e.Args)
+		}
+		if rec != nil {
+			rec.event(e, touched)
+		}
+		handle(e, touched)
+	}
+
+	tracer = strace.New(strace.Options{OnSyscall: onSyscall, Follow: *follow, Sample: sample, Subreaper: *subreaper, OnProcess: func(e strace.ProcessEvent) {
+		if tree != nil {
+			tree.process(e)
+		}
+		if collapse != nil && e.Kind == strace.Exited {
+			collapse.flush(os.Stdout, e.PID)
+		}
+	}})
+	stop = tracer.Detach
+	if replaying == nil {
+		handleInterrupt(tracer)
+	}
+	if *startAfter == 0 {
+		startWindow(tracer)
+	}
+	if *controlPath != "" {
+		if control, err = newControlServer(*controlPath, map[string]controlCommand{
+			"pause":  func(io.Writer, string) error { tracer.Pause(); return nil },
+			"resume": func(io.Writer, string) error { tracer.Resume(); return nil },
+			"detach": func(io.Writer, string) error { tracer.Detach(); return nil },
+			"set-filter": func(_ io.Writer, expr string) error {
+				f, err := parseFilter(expr, groups)
+				if err == nil {
+					filter = f
+				}
+				return err
+			},
+			"dump-summary": func(w io.Writer, _ string) error {
+				printCounts(w)
+				return nil
+			},
+		}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *killAfter > 0 && replaying == nil {
+		time.AfterFunc(*killAfter, func() {
+			fmt.Printf(">>>killing after %v\n", *killAfter)
+			tracer.Kill()
+		})
+	}
+
+	var res *strace.Result
+	if replaying != nil {
+		fmt.Printf(">>>replaying %s (%v)\n", flag.Arg(0), replaying.command)
+
+		stopped := false
+		stop = func() { stopped = true }
+		onProcess := func(pid int, name string) {
+			if trace != nil {
+				trace.processName(pid, name)
+			}
+			if folded != nil {
+				folded.comms[pid] = name
+			}
+			if otlp != nil {
+				otlp.begin(pid, name)
+			}
+		}
+		res, err = replaying.replay(onProcess, handle, func() bool { return stopped })
+	} else if *attachPid != 0 {
+		name := procName(*attachPid)
+		if trace != nil {
+			trace.processName(*attachPid, name)
+		}
+		if otlp != nil {
+			otlp.begin(*attachPid, name)
+		}
+		if *startAfter > 0 {
+			fmt.Printf(">>>attaching to %d (%s) in %v\n", *attachPid, name, *startAfter)
+			res, err = attachAfter(tracer, *attachPid, *startAfter)
 		} else {
-			stage = "enter"
-			syscallCounter[regName] += 1
+			fmt.Printf(">>>attaching to %d (%s)\n", *attachPid, name)
+			res, err = tracer.Attach(*attachPid)
 		}
+	} else {
+		fmt.Printf(">>>running %s with args %s\n", args[0], args[1:])
 
-		// continue to the next syscall enter or exit
-		syscall.PtraceSyscall(pid, 0)
+		stdout, oerr := newTraceeOutput(*stdoutPath, "stdout", os.Stdout)
+		if oerr != nil {
+			log.Fatal(oerr)
+		}
+		stderr, oerr := newTraceeOutput(*stderrPath, "stderr", os.Stderr)
+		if oerr != nil {
+			log.Fatal(oerr)
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = stdout.w
+		cmd.Stderr = stderr.w
+		setupCommand(cmd)
+		if *startAfter > 0 {
+			res, err = runAfter(tracer, cmd, *startAfter)
+		} else {
+			res, err = tracer.Run(cmd)
+		}
+		for _, out := range []*traceeOutput{stdout, stderr} {
+			if cerr := out.close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if trace != nil && res != nil {
+			trace.processName(res.Pid, args[0])
+		}
+		if otlp != nil && res != nil {
+			otlp.begin(res.Pid, args[0])
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		syscall.Wait4(pid, nil, 0, nil)
+	if control != nil {
+		control.close()
+	}
 
+	if rec != nil {
+		if err := rec.close(res); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	fmt.Println(">>>done")
-	for k, v := range syscallCounter {
-		fmt.Printf("%s -> %v \n", k, v)
+	if live != nil {
+		live.stop()
+	}
+	if collapse != nil {
+		collapse.flushAll(os.Stdout)
+	}
+	if periodic != nil {
+		periodic.stop()
+	}
+
+	if res.Detached {
+		fmt.Printf(">>>detached from %d\n", res.Pid)
+	} else {
+		fmt.Printf(">>>done, exit status %d\n", exitCode(res.Status))
+	}
+	if sample > 0 {
+		fmt.Printf(">>>sampled %v of the time, counts are of the sampled syscalls only\n", *sampleExpr)
+	}
+	if peekFaults > 0 {
+		fmt.Printf(">>>%d printed arguments pointed at unmapped memory, what could be read is marked <unreadable>\n", peekFaults)
+	}
+	printCounts(os.Stdout)
+	uring.print(os.Stdout)
+	if futexes != nil {
+		futexes.print(os.Stdout)
+	}
+	if memory != nil {
+		memory.print(os.Stdout)
+	}
+	if deny != nil {
+		deny.print(os.Stdout)
+	}
+	if libs != nil {
+		libs.print(os.Stdout)
+	}
+	if sequences != nil && *baselinePath != "" {
+		sequences.print(os.Stdout, *baselinePath)
+	}
+	if sequences != nil && *learnPath != "" {
+		if err := sequences.learn(*learnPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if tree != nil {
+		fmt.Println(">>>process tree")
+		tree.print(os.Stdout, *mergeTree)
+	}
+
+	if !res.Detached {
+		fmt.Println(">>>rusage")
+		printRusage(os.Stdout, &res.Rusage)
+	}
+
+	if *printHistogram {
+		fmt.Println(">>>latencies")
+		lat.print(os.Stdout)
+	}
+	if *histogramJSONPath != "" {
+		if err := lat.writeJSON(*histogramJSONPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if folded != nil {
+		if err := folded.write(*flamegraphPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if sum != nil {
+		if err := sum.writeJSON(*summaryJSONPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if profile != nil {
+		if res.Detached || sample > 0 {
+			fmt.Printf(">>>%s only allows the syscalls made while traced, the command can need more\n", *seccompPath)
+		}
+		if err := profile.write(*seccompPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if db != nil {
+		if err := db.close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if otlp != nil {
+		if err := otlp.close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if pcap != nil {
+		if err := pcap.close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if trace != nil {
+		if err := trace.write(*chromeTracePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	os.Exit(exitCode(res.Status))
+}
+
+// replayableFlags refuses the flags that need a live tracee, either to read its memory or because they're about wall clock time
+func replayableFlags() error {
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "p", "f", "pcap", "unix-peers", "io-uring", "top", "interval", "duration", "kill-after", "record", "stdout", "stderr", "annotate-output", "env", "chdir", "uid", "gid", "sample", "libs", "meter", "security", "host-paths", "thread-name", "start-after", "trace-for", "control", "subreaper", "dump-io":
+			if err == nil {
+				err = fmt.Errorf("-%s needs a live tracee and can't be used with replay", f.Name)
+			}
+		case "deny":
+			if !*dryRun && err == nil {
+				err = fmt.Errorf("-deny needs a live tracee, it can only be tried out on a replay with -dry-run")
+			}
+		}
+	})
+	return err
+}
+
+// parseSample reads -sample as a fraction, 1/100 or 0.01
+func parseSample(expr string) (float64, error) {
+	if expr == "" {
+		return 0, nil
+	}
+	var f float64
+	if num, den, ok := strings.Cut(expr, "/"); ok {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, fmt.Errorf("-sample %q isn't a fraction like 1/100", expr)
+		}
+		f = n / d
+	} else {
+		var err error
+		if f, err = strconv.ParseFloat(expr, 64); err != nil {
+			return 0, fmt.Errorf("-sample %q isn't a fraction like 1/100", expr)
+		}
+	}
+	if f <= 0 || f > 1 {
+		return 0, fmt.Errorf("-sample %q has to be more than 0 and at most 1", expr)
+	}
+	return f, nil
+}
+
+// tracedCommand is what's being traced, for the outputs that record it
+func tracedCommand(args []string, replaying *traceReader) []string {
+	switch {
+	case replaying != nil:
+		return replaying.command
+	case *attachPid != 0:
+		return []string{procName(*attachPid)}
 	}
+	return args
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memoryTracker follows how much address space the tracee maps, from its mmap, munmap, mremap and brk calls.
+// that's mapped, not resident: a mapping only costs memory once it's touched, see max rss for that. what
+// the kernel maps itself on exec (the binary, the loader, the stack) isn't seen
+type memoryTracker struct {
+	start  time.Time
+	spaces map[int]*addressSpace // by thread group
+	tgids  threadGroups
+
+	mapped   uint64 // across all the processes
+	peak     uint64
+	total    uint64 // every byte ever mapped or added to a heap
+	mmaps    int
+	munmaps  int
+	timeline []memorySample
+}
+
+type memorySample struct {
+	at     time.Duration
+	mapped uint64
+}
+
+// addressSpace is the mappings of one process, sorted and not overlapping
+type addressSpace struct {
+	regions          []region
+	brkStart, brkEnd uint64
+}
+
+type region struct {
+	start, end uint64
+}
+
+const (
+	pageSize = 4096
+
+	// rows of the printed timeline
+	memoryTimelineRows = 20
+)
+
+func newMemoryTracker() *memoryTracker {
+	return &memoryTracker{start: time.Now(), spaces: map[int]*addressSpace{}, tgids: threadGroups{}}
+}
+
+// exit records a syscall that just returned, given its entry args
+func (m *memoryTracker) exit(pid int, name string, args [6]uint64, ret int64, now time.Time) {
+	if ret < 0 && ret > -4096 {
+		return
+	}
+	tgid := m.tgids.of(pid)
+	a, ok := m.spaces[tgid]
+	if !ok {
+		a = &addressSpace{}
+		m.spaces[tgid] = a
+	}
+
+	before := a.size()
+	switch name {
+	case "mmap":
+		start := uint64(ret)
+		m.mmaps++
+		m.total += pageAlign(args[1])
+		a.unmap(start, start+pageAlign(args[1]))
+		a.mapRegion(start, start+pageAlign(args[1]))
+	case "munmap":
+		m.munmaps++
+		a.unmap(args[0], args[0]+pageAlign(args[1]))
+	case "mremap":
+		oldSize, newSize := pageAlign(args[1]), pageAlign(args[2])
+		if newSize > oldSize {
+			m.total += newSize - oldSize
+		}
+		a.unmap(args[0], args[0]+oldSize)
+		a.mapRegion(uint64(ret), uint64(ret)+newSize)
+	case "brk":
+		// the first brk is the allocator asking where the heap starts
+		if a.brkStart == 0 {
+			a.brkStart = uint64(ret)
+		}
+		if end := uint64(ret); end > a.brkEnd {
+			m.total += end - max64(a.brkEnd, a.brkStart)
+		}
+		a.brkEnd = uint64(ret)
+	case "execve", "execveat":
+		// a successful exec replaces the whole address space
+		*a = addressSpace{}
+	default:
+		return
+	}
+
+	m.mapped = m.mapped - before + a.size()
+	if m.mapped > m.peak {
+		m.peak = m.mapped
+	}
+	m.timeline = append(m.timeline, memorySample{now.Sub(m.start), m.mapped})
+}
+
+func (a *addressSpace) size() uint64 {
+	var n uint64
+	for _, r := range a.regions {
+		n += r.end - r.start
+	}
+	if a.brkEnd > a.brkStart {
+		n += a.brkEnd - a.brkStart
+	}
+	return n
+}
+
+func (a *addressSpace) mapRegion(start, end uint64) {
+	i := sort.Search(len(a.regions), func(i int) bool { return a.regions[i].start >= start })
+	a.regions = append(a.regions, region{})
+	copy(a.regions[i+1:], a.regions[i:])
+	a.regions[i] = region{start, end}
+}
+
+// unmap cuts [start, end) out of the mappings, which can split one in two
+func (a *addressSpace) unmap(start, end uint64) {
+	var kept []region
+	for _, r := range a.regions {
+		if r.end <= start || r.start >= end {
+			kept = append(kept, r)
+			continue
+		}
+		if r.start < start {
+			kept = append(kept, region{r.start, start})
+		}
+		if r.end > end {
+			kept = append(kept, region{end, r.end})
+		}
+	}
+	a.regions = kept
+}
+
+func (m *memoryTracker) print(w io.Writer) {
+	fmt.Fprintln(w, ">>>address space")
+	fmt.Fprintf(w, "peak mapped  %d KiB\n", m.peak/1024)
+	fmt.Fprintf(w, "total mapped %d KiB over %d mmaps, %d munmaps\n", m.total/1024, m.mmaps, m.munmaps)
+	if len(m.timeline) == 0 {
+		return
+	}
+
+	// the largest size in each slice of the run, so short peaks still show up
+	end := m.timeline[len(m.timeline)-1].at
+	step := end/memoryTimelineRows + 1
+	rows := make([]uint64, memoryTimelineRows)
+	changed := make([]bool, memoryTimelineRows)
+	for _, s := range m.timeline {
+		if i := int(s.at / step); !changed[i] || s.mapped > rows[i] {
+			rows[i], changed[i] = s.mapped, true
+		}
+	}
+	for i := range rows {
+		// carry the size over slices where nothing changed
+		if i > 0 && !changed[i] {
+			rows[i] = rows[i-1]
+		}
+		bar := 0
+		if m.peak > 0 {
+			bar = int(rows[i] * 40 / m.peak)
+		}
+		fmt.Fprintf(w, "%10v %8d KiB %s\n", (time.Duration(i) * step).Round(time.Microsecond), rows[i]/1024, strings.Repeat("#", bar))
+	}
+}
+
+func pageAlign(n uint64) uint64 {
+	return (n + pageSize - 1) &^ (pageSize - 1)
+}
+
+func max64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// pidList collects repeated -p flags
+type pidList []int
+
+func (p *pidList) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *pidList) Set(v string) error {
+	pid, err := strconv.Atoi(v)
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("bad pid %q", v)
+	}
+	*p = append(*p, pid)
+	return nil
+}
+
+// shellCommands collects repeated -cmd flags, each a shell command line
+type shellCommands []string
+
+func (c *shellCommands) String() string {
+	return strings.Join(*c, "; ")
+}
+
+func (c *shellCommands) Set(v string) error {
+	*c = append(*c, v)
+	return nil
+}
+
+// multiTarget is one of the traces run side by side, a command to start or a process to attach to
+type multiTarget struct {
+	label string
+	cmd   []string
+	pid   int
+
+	run    benchRun
+	res    *strace.Result
+	err    error
+	tracer *strace.Tracer
+}
+
+// runMulti implements `multi [-cmd "..."]... [-p pid]... [-- cmdA args -- cmdB args]`, tracing every target
+// at the same time, each in its own trace loop, and printing their syscall counts side by side or merged
+func runMulti(args []string) int {
+	fs := flag.NewFlagSet("multi", flag.ExitOnError)
+	var cmds shellCommands
+	var pids pidList
+	fs.Var(&cmds, "cmd", "a shell command line to trace, can be repeated")
+	fs.Var(&pids, "p", "a running process to attach to, can be repeated")
+	follow := fs.Bool("f", false, "trace the children and threads of every target too")
+	merge := fs.Bool("merge", false, "print one summary of all the targets together instead of one column per target")
+	filterExpr := fs.String("e", "", "only count these comma separated syscalls")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s multi [flags] [-cmd \"<cmdA>\"]... [-p <pid>]... [-- <cmdB> [args...] -- ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var targets []*multiTarget
+	for _, cmd := range cmds {
+		targets = append(targets, &multiTarget{label: cmd, cmd: []string{"sh", "-c", cmd}})
+	}
+	for _, cmd := range splitCommands(fs.Args()) {
+		targets = append(targets, &multiTarget{label: strings.Join(cmd, " "), cmd: cmd})
+	}
+	for _, pid := range pids {
+		targets = append(targets, &multiTarget{label: fmt.Sprintf("-p %d", pid), pid: pid})
+	}
+	if len(targets) == 0 {
+		fs.Usage()
+		return 2
+	}
+	filter, err := parseFilter(*filterExpr, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// every target gets its own tracer, which locks the goroutine running it to a thread of its own
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		t := t
+		t.run = benchRun{}
+		t.tracer = strace.New(strace.Options{
+			Follow: *follow,
+			OnSyscall: func(e strace.SyscallEvent) {
+				if e.Stage != strace.Exit || !filter.match(e.Name) {
+					return
+				}
+				c, ok := t.run[e.Name]
+				if !ok {
+					c = &benchCount{}
+					t.run[e.Name] = c
+				}
+				c.calls++
+				c.time += e.Duration
+			},
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if t.pid != 0 {
+				t.res, t.err = t.tracer.Attach(t.pid)
+			} else {
+				cmd := exec.Command(t.cmd[0], t.cmd[1:]...)
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+				t.res, t.err = t.tracer.Run(cmd)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case t.err != nil:
+				fmt.Fprintf(os.Stderr, ">>>%s: %v\n", t.label, t.err)
+			case t.res.Detached:
+				fmt.Printf(">>>%s: detached from %d\n", t.label, t.res.Pid)
+			default:
+				fmt.Printf(">>>%s: done, exit status %d\n", t.label, exitCode(t.res.Status))
+			}
+		}()
+	}
+
+	// like a single trace, an interrupt detaches from everything and still prints the summary
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		for _, t := range targets {
+			t.tracer.Detach()
+		}
+	}()
+	wg.Wait()
+
+	printMulti(os.Stdout, targets, *merge)
+	for _, t := range targets {
+		if t.err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printMulti(w io.Writer, targets []*multiTarget, merge bool) {
+	labels := make([]string, len(targets))
+	runs := make([]benchRun, len(targets))
+	for i, t := range targets {
+		labels[i], runs[i] = t.label, t.run
+	}
+	if merge {
+		all := benchRun{}
+		for _, run := range runs {
+			for name, c := range run {
+				if _, ok := all[name]; !ok {
+					all[name] = &benchCount{}
+				}
+				all[name].calls += c.calls
+				all[name].time += c.time
+			}
+		}
+		labels, runs = []string{strings.Join(labels, " + ")}, []benchRun{all}
+	}
+
+	seen := map[string]bool{}
+	for _, run := range runs {
+		for name := range run {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w)
+	for i, label := range labels {
+		fmt.Fprintf(w, "[%c] %s\n", 'A'+i, label)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%-20s", "SYSCALL")
+	for i := range labels {
+		fmt.Fprintf(w, " %12s %14s", fmt.Sprintf("[%c] CALLS", 'A'+i), fmt.Sprintf("[%c] TIME", 'A'+i))
+	}
+	fmt.Fprintln(w)
+
+	row := func(label string, pick func(benchRun) benchCount) {
+		fmt.Fprintf(w, "%-20s", label)
+		for _, run := range runs {
+			c := pick(run)
+			fmt.Fprintf(w, " %12d %14v", c.calls, c.time.Round(time.Microsecond))
+		}
+		fmt.Fprintln(w)
+	}
+	for _, name := range names {
+		row(name, func(run benchRun) benchCount {
+			if c, ok := run[name]; ok {
+				return *c
+			}
+			return benchCount{}
+		})
+	}
+	row("total", func(run benchRun) benchCount {
+		var total benchCount
+		for _, c := range run {
+			total.calls += c.calls
+			total.time += c.time
+		}
+		return total
+	})
+}
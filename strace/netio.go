@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// socketIO is data a tracee sent or received on an inet socket in a single syscall
+type socketIO struct {
+	src, dst netip.AddrPort
+	tcp      bool
+	data     []byte
+}
+
+// ioSyscalls are the read/write style syscalls, and whether their data goes out
+var ioSyscalls = map[string]bool{
+	"write": true, "pwrite64": true, "writev": true, "pwritev": true, "sendto": true, "sendmsg": true,
+	"read": false, "pread64": false, "readv": false, "preadv": false, "recvfrom": false, "recvmsg": false,
+}
+
+// ioBuffer reads the data of a read/write style syscall that just returned ret bytes, given its entry args
+func ioBuffer(pid int, name string, args [6]uint64, ret int64) ([]byte, error) {
+	switch name {
+	case "writev", "readv", "pwritev", "preadv":
+		return peekIovec(pid, uintptr(args[1]), int(args[2]), int(ret))
+	case "sendmsg", "recvmsg":
+		// struct msghdr { void *msg_name; socklen_t msg_namelen; struct iovec *msg_iov; size_t msg_iovlen; ... }
+		hdr, err := strace.PeekData(pid, uintptr(args[1]), 32)
+		if err != nil {
+			return nil, err
+		}
+		return peekIovec(pid, uintptr(binary.LittleEndian.Uint64(hdr[16:])), int(binary.LittleEndian.Uint64(hdr[24:])), int(ret))
+	}
+	return strace.PeekData(pid, uintptr(args[1]), int(ret))
+}
+
+// captureSocketIO returns the payload of a read/write style syscall that just returned, given its entry args.
+// ok is false for other syscalls, failed calls, and fds that aren't tcp/udp sockets
+func captureSocketIO(pid int, name string, args [6]uint64, ret int64) (socketIO, bool) {
+	if ret <= 0 {
+		return socketIO{}, false
+	}
+
+	outgoing, ok := ioSyscalls[name]
+	if !ok {
+		return socketIO{}, false
+	}
+
+	fd := int(args[0])
+	if !isSocket(pid, fd) {
+		return socketIO{}, false
+	}
+	local, remote, tcp, ok := inetSocket(pid, fd)
+	if !ok {
+		return socketIO{}, false
+	}
+
+	data, err := ioBuffer(pid, name, args, ret)
+	if err != nil {
+		return socketIO{}, false
+	}
+	// unconnected udp sockets name the other side in the call
+	switch name {
+	case "sendto", "recvfrom":
+		if args[4] != 0 && !remote.IsValid() {
+			addrLen := int(args[5])
+			if name == "recvfrom" {
+				addrLen = peekUint32(pid, uintptr(args[5]))
+			}
+			remote, _ = readSockaddrInet(pid, uintptr(args[4]), addrLen)
+		}
+	case "sendmsg", "recvmsg":
+		if hdr, err := strace.PeekData(pid, uintptr(args[1]), 16); err == nil {
+			if addr := binary.LittleEndian.Uint64(hdr); addr != 0 && !remote.IsValid() {
+				remote, _ = readSockaddrInet(pid, uintptr(addr), int(binary.LittleEndian.Uint32(hdr[8:])))
+			}
+		}
+	}
+
+	if !remote.IsValid() {
+		remote = netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+		if local.Addr().Is6() {
+			remote = netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+		}
+	}
+
+	captured := socketIO{src: remote, dst: local, tcp: tcp, data: data}
+	if outgoing {
+		captured.src, captured.dst = local, remote
+	}
+	return captured, true
+}
+
+// isSocket checks the fd link, which is cheaper than copying the fd over
+func isSocket(pid, fd int) bool {
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, fd))
+	return err == nil && strings.HasPrefix(link, "socket:")
+}
+
+// inetSocket looks up the addresses of a tracee's tcp or udp socket, remote is invalid for unconnected sockets
+func inetSocket(pid, fd int) (local, remote netip.AddrPort, tcp bool, ok bool) {
+	f, err := strace.GetFd(pid, fd)
+	if err != nil {
+		return
+	}
+	defer syscall.Close(f)
+
+	sa, err := syscall.Getsockname(f)
+	if err != nil {
+		return
+	}
+	if local, ok = sockaddrToAddrPort(sa); !ok {
+		return
+	}
+	if sa, err := syscall.Getpeername(f); err == nil {
+		remote, _ = sockaddrToAddrPort(sa)
+	}
+
+	typ, err := syscall.GetsockoptInt(f, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return local, remote, false, false
+	}
+	return local, remote, typ == syscall.SOCK_STREAM, true
+}
+
+func sockaddrToAddrPort(sa syscall.Sockaddr) (netip.AddrPort, bool) {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return netip.AddrPortFrom(netip.AddrFrom4(sa.Addr), uint16(sa.Port)), true
+	case *syscall.SockaddrInet6:
+		return netip.AddrPortFrom(netip.AddrFrom16(sa.Addr), uint16(sa.Port)), true
+	}
+	return netip.AddrPort{}, false
+}
+
+// readSockaddrInet reads a struct sockaddr_in/sockaddr_in6 from the tracee
+func readSockaddrInet(pid int, addr uintptr, length int) (netip.AddrPort, bool) {
+	if length < 8 || length > 128 {
+		return netip.AddrPort{}, false
+	}
+	b, err := strace.PeekData(pid, addr, length)
+	if err != nil || len(b) < 8 {
+		return netip.AddrPort{}, false
+	}
+
+	port := binary.BigEndian.Uint16(b[2:])
+	switch binary.LittleEndian.Uint16(b) {
+	case syscall.AF_INET:
+		return netip.AddrPortFrom(netip.AddrFrom4([4]byte{b[4], b[5], b[6], b[7]}), port), true
+	case syscall.AF_INET6:
+		if len(b) < 24 {
+			return netip.AddrPort{}, false
+		}
+		var a [16]byte
+		copy(a[:], b[8:24])
+		return netip.AddrPortFrom(netip.AddrFrom16(a), port), true
+	}
+	return netip.AddrPort{}, false
+}
+
+func peekUint32(pid int, addr uintptr) int {
+	b, err := strace.PeekData(pid, addr, 4)
+	if err != nil || len(b) < 4 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(b))
+}
+
+// peekIovec gathers up to total bytes from the tracee's struct iovec array
+func peekIovec(pid int, iov uintptr, count, total int) ([]byte, error) {
+	var data []byte
+	for i := 0; i < count && len(data) < total; i++ {
+		vec, err := strace.PeekData(pid, iov+uintptr(16*i), 16)
+		if err != nil {
+			return nil, err
+		}
+		base := binary.LittleEndian.Uint64(vec)
+		n := int(binary.LittleEndian.Uint64(vec[8:]))
+		if n > total-len(data) {
+			n = total - len(data)
+		}
+		b, err := strace.PeekData(pid, uintptr(base), n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
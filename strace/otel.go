@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otlpExporter sends syscalls as spans to an opentelemetry collector over OTLP/HTTP with json encoding
+// (https://opentelemetry.io/docs/specs/otlp/#otlphttp), batching them in the background so the tracee
+// isn't held up by the network.
+// every span is a child of a span covering the whole trace, sent when the trace ends, which itself can be
+// parented to an application span with a W3C traceparent, so kernel activity shows up inside the application's own traces
+type otlpExporter struct {
+	url      string
+	client   *http.Client
+	resource []otlpAttribute
+
+	traceID  string
+	rootID   string
+	parentID string // of the root span, from traceparent
+	start    time.Time
+
+	window time.Duration // aggregate syscalls into one span per syscall per window
+	agg    map[string]*otlpAgg
+
+	mu      sync.Mutex
+	pending []otlpSpan
+	err     error
+
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+type otlpAgg struct {
+	start  time.Time
+	calls  int
+	errors int
+	total  time.Duration
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID      string            `json:"traceId"`
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Name         string            `json:"name"`
+	Kind         int               `json:"kind"`
+	Start        string            `json:"startTimeUnixNano"`
+	End          string            `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute   `json:"attributes,omitempty"`
+	Status       map[string]string `json:"status,omitempty"`
+}
+
+const otlpSpanKindInternal = 1
+
+func stringAttr(key, value string) otlpAttribute {
+	return otlpAttribute{key, map[string]string{"stringValue": value}}
+}
+
+func intAttr(key string, value int64) otlpAttribute {
+	// 64 bit ints are strings in the json encoding
+	return otlpAttribute{key, map[string]string{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+// newOTLPExporter exports to the collector at endpoint (eg http://localhost:4318),
+// traceparent is an optional W3C traceparent header value to put the spans under
+func newOTLPExporter(endpoint, traceparent string, window time.Duration) (*otlpExporter, error) {
+	e := &otlpExporter{
+		url:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: 10 * time.Second},
+		// until begin knows the traced process
+		resource: []otlpAttribute{stringAttr("service.name", "strace")},
+		traceID:  randomHex(16),
+		rootID:   randomHex(8),
+		start:    time.Now(),
+		window:   window,
+		agg:      map[string]*otlpAgg{},
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if traceparent != "" {
+		// version-traceid-parentid-flags
+		parts := strings.Split(traceparent, "-")
+		if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+			return nil, fmt.Errorf("bad traceparent %q", traceparent)
+		}
+		e.traceID, e.parentID = parts[1], parts[2]
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// begin names the root span and the resource once we know what we're tracing
+func (e *otlpExporter) begin(pid int, name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resource = []otlpAttribute{
+		stringAttr("service.name", "strace"),
+		intAttr("process.pid", int64(pid)),
+		stringAttr("process.executable.name", name),
+	}
+}
+
+func (e *otlpExporter) syscall(pid int, name string, enter, exit time.Time, ret int64, failed bool) {
+	if e.window > 0 {
+		e.aggregate(name, enter, exit, failed)
+		return
+	}
+
+	span := otlpSpan{
+		TraceID:      e.traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: e.rootID,
+		Name:         name,
+		Kind:         otlpSpanKindInternal,
+		Start:        unixNano(enter),
+		End:          unixNano(exit),
+		Attributes: []otlpAttribute{
+			intAttr("process.pid", int64(pid)),
+			intAttr("syscall.return", ret),
+		},
+	}
+	if failed {
+		span.Status = map[string]string{"code": "STATUS_CODE_ERROR"}
+	}
+
+	e.mu.Lock()
+	e.pending = append(e.pending, span)
+	e.mu.Unlock()
+}
+
+func (e *otlpExporter) aggregate(name string, enter, exit time.Time, failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w, ok := e.agg[name]
+	if !ok {
+		w = &otlpAgg{start: enter}
+		e.agg[name] = w
+	}
+	w.calls++
+	w.total += exit.Sub(enter)
+	if failed {
+		w.errors++
+	}
+}
+
+// flushWindows turns the aggregated windows into spans, with e.mu held
+func (e *otlpExporter) flushWindows(now time.Time) {
+	for name, w := range e.agg {
+		e.pending = append(e.pending, otlpSpan{
+			TraceID:      e.traceID,
+			SpanID:       randomHex(8),
+			ParentSpanID: e.rootID,
+			Name:         name,
+			Kind:         otlpSpanKindInternal,
+			Start:        unixNano(w.start),
+			End:          unixNano(now),
+			Attributes: []otlpAttribute{
+				intAttr("syscall.count", int64(w.calls)),
+				intAttr("syscall.errors", int64(w.errors)),
+				intAttr("syscall.total_ns", int64(w.total)),
+			},
+		})
+	}
+	e.agg = map[string]*otlpAgg{}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+
+	interval := time.Second
+	if e.window > 0 {
+		interval = e.window
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopped:
+			return
+		case now := <-ticker.C:
+			e.mu.Lock()
+			e.flushWindows(now)
+			e.mu.Unlock()
+			e.send()
+		}
+	}
+}
+
+// close ends the root span and sends everything that's left, returning the first export error
+func (e *otlpExporter) close() error {
+	close(e.stopped)
+	<-e.done
+
+	now := time.Now()
+	e.mu.Lock()
+	e.flushWindows(now)
+	e.pending = append(e.pending, otlpSpan{
+		TraceID:      e.traceID,
+		SpanID:       e.rootID,
+		ParentSpanID: e.parentID,
+		Name:         "strace",
+		Kind:         otlpSpanKindInternal,
+		Start:        unixNano(e.start),
+		End:          unixNano(now),
+	})
+	e.mu.Unlock()
+
+	e.send()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+func (e *otlpExporter) send() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	resource := e.resource
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "strace"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err == nil {
+		var resp *http.Response
+		resp, err = e.client.Post(e.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("otlp export to %s: %s", e.url, resp.Status)
+			}
+		}
+	}
+
+	if err != nil {
+		e.mu.Lock()
+		if e.err == nil {
+			e.err = err
+		}
+		e.mu.Unlock()
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// the tracee's stdout and stderr normally interleave with our own output. -stdout and -stderr send them to
+// files instead, and -annotate-output keeps them inline but marks every line, so both stay parseable
+
+// traceeOutput is where one of the tracee's streams goes
+type traceeOutput struct {
+	w     io.Writer
+	close func() error
+}
+
+// annotated lines are written whole under this, so the tracee's two streams can't tear each other's lines.
+// a detached tracee can still be writing while we flush, so it covers the unfinished lines too
+var annotateMu sync.Mutex
+
+func newTraceeOutput(path, marker string, std *os.File) (*traceeOutput, error) {
+	switch {
+	case path != "":
+		// the tracee writes straight to the file, exec doesn't need a pipe for an *os.File
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &traceeOutput{w: f, close: f.Close}, nil
+	case *annotateOutput:
+		w := &markedLines{w: os.Stdout, marker: []byte(">>>" + marker + ": ")}
+		return &traceeOutput{w: w, close: w.flush}, nil
+	}
+	return &traceeOutput{w: std, close: func() error { return nil }}, nil
+}
+
+// markedLines prefixes every line written to it with marker
+type markedLines struct {
+	w      io.Writer
+	marker []byte
+	line   []byte // the unfinished last line
+}
+
+func (m *markedLines) Write(p []byte) (int, error) {
+	annotateMu.Lock()
+	defer annotateMu.Unlock()
+	m.line = append(m.line, p...)
+	for {
+		i := bytes.IndexByte(m.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := m.writeLine(m.line[:i+1]); err != nil {
+			return 0, err
+		}
+		m.line = m.line[i+1:]
+	}
+}
+
+// flush writes out a last line without a newline, once the tracee is done
+func (m *markedLines) flush() error {
+	annotateMu.Lock()
+	defer annotateMu.Unlock()
+	if len(m.line) == 0 {
+		return nil
+	}
+	err := m.writeLine(append(m.line, '\n'))
+	m.line = nil
+	return err
+}
+
+func (m *markedLines) writeLine(line []byte) error {
+	_, err := m.w.Write(append(append([]byte{}, m.marker...), line...))
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// pathArg says where a syscall takes a path, and the dirfd it's relative to for the *at calls (-1 for none)
+type pathArg struct {
+	dirfd, path int
+}
+
+// the syscalls that take paths, and the ones that work on an already open fd in their first argument
+var (
+	pathArgs = map[string][]pathArg{
+		"open": {{-1, 0}}, "creat": {{-1, 0}}, "openat": {{0, 1}}, "openat2": {{0, 1}},
+		"stat": {{-1, 0}}, "lstat": {{-1, 0}}, "newfstatat": {{0, 1}}, "statx": {{0, 1}}, "statfs": {{-1, 0}},
+		"access": {{-1, 0}}, "faccessat": {{0, 1}}, "faccessat2": {{0, 1}},
+		"execve": {{-1, 0}}, "execveat": {{0, 1}},
+		"readlink": {{-1, 0}}, "readlinkat": {{0, 1}},
+		"unlink": {{-1, 0}}, "unlinkat": {{0, 1}}, "mkdir": {{-1, 0}}, "mkdirat": {{0, 1}}, "rmdir": {{-1, 0}},
+		"mknod": {{-1, 0}}, "mknodat": {{0, 1}},
+		"rename": {{-1, 0}, {-1, 1}}, "renameat": {{0, 1}, {2, 3}}, "renameat2": {{0, 1}, {2, 3}},
+		"link": {{-1, 0}, {-1, 1}}, "linkat": {{0, 1}, {2, 3}}, "symlink": {{-1, 1}}, "symlinkat": {{1, 2}},
+		"chdir": {{-1, 0}}, "chroot": {{-1, 0}}, "truncate": {{-1, 0}},
+		"chmod": {{-1, 0}}, "fchmodat": {{0, 1}}, "chown": {{-1, 0}}, "lchown": {{-1, 0}}, "fchownat": {{0, 1}},
+		"utime": {{-1, 0}}, "utimes": {{-1, 0}}, "utimensat": {{0, 1}},
+		"getxattr": {{-1, 0}}, "lgetxattr": {{-1, 0}}, "setxattr": {{-1, 0}}, "lsetxattr": {{-1, 0}},
+		"listxattr": {{-1, 0}}, "llistxattr": {{-1, 0}}, "removexattr": {{-1, 0}}, "lremovexattr": {{-1, 0}},
+		"inotify_add_watch": {{-1, 1}},
+	}
+	fdSyscalls = map[string]bool{
+		"read": true, "write": true, "pread64": true, "pwrite64": true, "readv": true, "writev": true,
+		"preadv": true, "pwritev": true, "preadv2": true, "pwritev2": true, "lseek": true, "close": true,
+		"fstat": true, "fstatfs": true, "fsync": true, "fdatasync": true, "ftruncate": true, "fallocate": true,
+		"getdents64": true, "fchmod": true, "fchown": true, "fchdir": true, "flock": true, "fcntl": true,
+		"fgetxattr": true, "fsetxattr": true, "flistxattr": true, "fremovexattr": true, "sendfile": true,
+		"copy_file_range": true, "splice": true, "ioctl": true,
+	}
+)
+
+const atFdcwd = -100
+
+// pathFilter keeps only the syscalls that touch files under one of its prefixes, a nil filter keeps everything
+type pathFilter []string
+
+func (f *pathFilter) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *pathFilter) Set(v string) error {
+	p, err := filepath.Abs(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+// match reports whether any of the paths a syscall touches is under one of the prefixes
+func (f pathFilter) match(paths []string) bool {
+	if f == nil {
+		return true
+	}
+	for _, path := range paths {
+		if f.under(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// touchedPaths are the absolute paths a syscall is about to use, read on syscall entry so relative paths
+// resolve against the cwd and fds the tracee has right now. they're the paths as the tracee sees them,
+// which for one in a container or a chroot isn't where they are on the host, see traceeView
+func touchedPaths(pid int, name string, args [6]uint64) []string {
+	if fdSyscalls[name] {
+		link, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, int32(args[0])))
+		if err != nil {
+			return nil
+		}
+		return []string{traceeView(traceeRoot(pid), link)}
+	}
+
+	var paths []string
+	for _, a := range pathArgs[name] {
+		path, err := strace.PeekString(pid, uintptr(args[a.path]), 4096)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			dir, err := tracedDir(pid, a.dirfd, args)
+			if err != nil {
+				continue
+			}
+			path = filepath.Join(dir, path)
+		}
+		paths = append(paths, filepath.Clean(path))
+	}
+	return paths
+}
+
+// tracedDir is the directory a relative path is resolved against, its cwd or the dirfd of an *at syscall
+func tracedDir(pid, dirfd int, args [6]uint64) (string, error) {
+	link := fmt.Sprintf("/proc/%d/cwd", pid)
+	if dirfd >= 0 && int32(args[dirfd]) != atFdcwd {
+		link = fmt.Sprintf("/proc/%d/fd/%d", pid, int32(args[dirfd]))
+	}
+	dir, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	return traceeView(traceeRoot(pid), dir), nil
+}
+
+// traceeRoot is the tracee's root directory on the host, / unless it's in a container or a chroot
+func traceeRoot(pid int) string {
+	root, err := os.Readlink(fmt.Sprintf("/proc/%d/root", pid))
+	if err != nil {
+		return "/"
+	}
+	return root
+}
+
+// traceeView turns a host path from one of the tracee's /proc links into the path the tracee sees, the
+// paths it passes to syscalls are already relative to its root
+func traceeView(root, path string) string {
+	switch {
+	case root == "/":
+		return path
+	case path == root:
+		return "/"
+	case strings.HasPrefix(path, root+"/"):
+		return path[len(root):]
+	}
+	return path
+}
+
+// hostView is where a path the tracee uses is on the host, relative ones resolved against its cwd or dirfd
+func hostView(pid int, root, path string, dirfd int, args [6]uint64) string {
+	if !filepath.IsAbs(path) {
+		dir, err := tracedDir(pid, dirfd, args)
+		if err != nil {
+			return ""
+		}
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Join(root, path)
+}
+
+func (f pathFilter) under(path string) bool {
+	for _, prefix := range f {
+		if prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// pcapWriter writes captured socket payloads as a pcapng file (https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html).
+// we only see the data the process read or wrote, so every payload is wrapped in made up ethernet/ip/tcp/udp headers
+// built from the socket addresses, which is enough for wireshark to dissect the protocol on top
+type pcapWriter struct {
+	f *os.File
+	w *bufio.Writer
+
+	seq map[flow]uint32 // next tcp sequence number per direction, so wireshark can reassemble streams
+}
+
+type flow struct {
+	src, dst netip.AddrPort
+}
+
+const (
+	pcapBlockSection   = 0x0a0d0d0a
+	pcapBlockInterface = 0x00000001
+	pcapBlockPacket    = 0x00000006
+
+	pcapLinkEthernet = 1
+	pcapOptComment   = 1
+
+	// keep every fake packet under the 64k ip length limit
+	pcapMaxPayload = 65000
+)
+
+func newPcapWriter(path string) (*pcapWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &pcapWriter{f: f, w: bufio.NewWriter(f), seq: map[flow]uint32{}}
+
+	// section header: byte order magic, version 1.0, unknown section length
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb, 0x1a2b3c4d)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	p.block(pcapBlockSection, shb)
+
+	// a single ethernet interface with the default microsecond timestamps
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb, pcapLinkEthernet)
+	binary.LittleEndian.PutUint32(idb[4:], 0) // no snaplen limit
+	p.block(pcapBlockInterface, idb)
+
+	return p, nil
+}
+
+// block writes a pcapng block, padding the body to 32 bits
+func (p *pcapWriter) block(typ uint32, body []byte) {
+	body = pad4(body)
+	length := uint32(12 + len(body))
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], typ)
+	p.w.Write(b[:])
+	binary.LittleEndian.PutUint32(b[:], length)
+	p.w.Write(b[:])
+	p.w.Write(body)
+	p.w.Write(b[:])
+}
+
+// write records payload as one or more packets from src to dst, comment ends up in the packet's comment field
+func (p *pcapWriter) write(ts time.Time, src, dst netip.AddrPort, tcp bool, payload []byte, comment string) {
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > pcapMaxPayload {
+			n = pcapMaxPayload
+		}
+		p.packet(ts, src, dst, tcp, payload[:n], comment)
+		payload = payload[n:]
+	}
+}
+
+func (p *pcapWriter) packet(ts time.Time, src, dst netip.AddrPort, tcp bool, payload []byte, comment string) {
+	var transport []byte
+	if tcp {
+		f := flow{src, dst}
+		transport = tcpHeader(src.Port(), dst.Port(), p.seq[f])
+		p.seq[f] += uint32(len(payload))
+	} else {
+		transport = udpHeader(src.Port(), dst.Port(), len(payload))
+	}
+
+	proto := byte(17)
+	if tcp {
+		proto = 6
+	}
+	ip, etherType := ipHeader(src.Addr(), dst.Addr(), proto, len(transport)+len(payload))
+
+	frame := make([]byte, 14, 14+len(ip)+len(transport)+len(payload))
+	// zero mac addresses, just the ether type
+	binary.BigEndian.PutUint16(frame[12:], etherType)
+	frame = append(frame, ip...)
+	frame = append(frame, transport...)
+	frame = append(frame, payload...)
+
+	us := uint64(ts.UnixNano() / int64(time.Microsecond))
+	epb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(epb, 0) // interface id
+	binary.LittleEndian.PutUint32(epb[4:], uint32(us>>32))
+	binary.LittleEndian.PutUint32(epb[8:], uint32(us))
+	binary.LittleEndian.PutUint32(epb[12:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(len(frame)))
+	epb = append(epb, pad4(frame)...)
+
+	if comment != "" {
+		opt := make([]byte, 4)
+		binary.LittleEndian.PutUint16(opt, pcapOptComment)
+		binary.LittleEndian.PutUint16(opt[2:], uint16(len(comment)))
+		epb = append(epb, pad4(append(opt, comment...))...)
+		epb = append(epb, 0, 0, 0, 0) // opt_endofopt
+	}
+
+	p.block(pcapBlockPacket, epb)
+}
+
+func (p *pcapWriter) close() error {
+	if err := p.w.Flush(); err != nil {
+		p.f.Close()
+		return err
+	}
+	return p.f.Close()
+}
+
+func ipHeader(src, dst netip.Addr, proto byte, payloadLen int) ([]byte, uint16) {
+	if src.Is4() && dst.Is4() {
+		h := make([]byte, 20)
+		h[0] = 0x45 // v4, 5 words
+		binary.BigEndian.PutUint16(h[2:], uint16(20+payloadLen))
+		h[8] = 64 // ttl
+		h[9] = proto
+		s, d := src.As4(), dst.As4()
+		copy(h[12:], s[:])
+		copy(h[16:], d[:])
+		binary.BigEndian.PutUint16(h[10:], checksum(h))
+		return h, 0x0800
+	}
+
+	h := make([]byte, 40)
+	h[0] = 0x60 // v6
+	binary.BigEndian.PutUint16(h[4:], uint16(payloadLen))
+	h[6] = proto
+	h[7] = 64 // hop limit
+	s, d := src.As16(), dst.As16()
+	copy(h[8:], s[:])
+	copy(h[24:], d[:])
+	return h, 0x86dd
+}
+
+// tcpHeader is a PSH|ACK segment, checksums are left at zero which wireshark doesn't validate by default
+func tcpHeader(srcPort, dstPort uint16, seq uint32) []byte {
+	h := make([]byte, 20)
+	binary.BigEndian.PutUint16(h, srcPort)
+	binary.BigEndian.PutUint16(h[2:], dstPort)
+	binary.BigEndian.PutUint32(h[4:], seq)
+	h[12] = 5 << 4 // 5 words
+	h[13] = 0x18   // PSH|ACK
+	binary.BigEndian.PutUint16(h[14:], 0xffff)
+	return h
+}
+
+func udpHeader(srcPort, dstPort uint16, payloadLen int) []byte {
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint16(h, srcPort)
+	binary.BigEndian.PutUint16(h[2:], dstPort)
+	binary.BigEndian.PutUint16(h[4:], uint16(8+payloadLen))
+	return h
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+func pad4(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,113 @@
+package strace
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+//go:generate go run ./internal/argsgen args.txt args_gen.go
+
+// DecodeArgs returns the arguments of a syscall pid just entered as the struct of its syscall, like *OpenatArgs
+// with the path read from the tracee already, or nil for syscalls that aren't in args.txt and have no
+// RegisterDecoder. like PeekData it can only be used from an OnSyscall callback, Options.DecodeArgs does it
+// for every event instead
+func DecodeArgs(e SyscallEvent) any {
+	if e.Stage != Enter {
+		return nil
+	}
+	return decode(e.PID, e.Name, e.Args)
+}
+
+// SockAddr is a decoded struct sockaddr, IP and Port for AF_INET and AF_INET6, Path for AF_UNIX
+// (starting with @ for an abstract one), only Family for anything else
+type SockAddr struct {
+	Family int
+	IP     net.IP
+	Port   int
+	Path   string
+}
+
+func (a *SockAddr) String() string {
+	switch a.Family {
+	case syscall.AF_INET, syscall.AF_INET6:
+		return (&net.TCPAddr{IP: a.IP, Port: a.Port}).String()
+	case syscall.AF_UNIX:
+		return a.Path
+	}
+	return ""
+}
+
+// longest path or string, and most strings in an array, that are read
+const (
+	maxArgString  = 4096
+	maxArgStrings = 1024
+)
+
+func argFd(v uint64) int {
+	return int(int32(v))
+}
+
+func argPath(pid int, addr uint64) string {
+	if addr == 0 {
+		return ""
+	}
+	s, _ := PeekString(pid, uintptr(addr), maxArgString)
+	return s
+}
+
+func argStrings(pid int, addr uint64) []string {
+	if addr == 0 {
+		return nil
+	}
+	var strs []string
+	for len(strs) < maxArgStrings {
+		b, err := PeekData(pid, uintptr(addr), 8)
+		if err != nil || len(b) < 8 {
+			break
+		}
+		p := binary.LittleEndian.Uint64(b)
+		if p == 0 {
+			break
+		}
+		strs = append(strs, argPath(pid, p))
+		addr += 8
+	}
+	return strs
+}
+
+func argSockaddr(pid int, addr, length uint64) *SockAddr {
+	if addr == 0 || length < 2 {
+		return nil
+	}
+	if length > syscall.SizeofSockaddrAny {
+		length = syscall.SizeofSockaddrAny
+	}
+	b, err := PeekData(pid, uintptr(addr), int(length))
+	if err != nil || len(b) < 2 {
+		return nil
+	}
+	a := &SockAddr{Family: int(binary.LittleEndian.Uint16(b))}
+	switch {
+	case a.Family == syscall.AF_INET && len(b) >= 8:
+		a.Port = int(binary.BigEndian.Uint16(b[2:]))
+		a.IP = net.IP(append([]byte(nil), b[4:8]...))
+	case a.Family == syscall.AF_INET6 && len(b) >= 24:
+		a.Port = int(binary.BigEndian.Uint16(b[2:]))
+		a.IP = net.IP(append([]byte(nil), b[8:24]...))
+	case a.Family == syscall.AF_UNIX:
+		path := b[2:]
+		if len(path) > 0 && path[0] == 0 {
+			a.Path = "@" + string(path[1:])
+		} else {
+			for i, c := range path {
+				if c == 0 {
+					path = path[:i]
+					break
+				}
+			}
+			a.Path = string(path)
+		}
+	}
+	return a
+}
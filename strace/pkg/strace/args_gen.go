@@ -0,0 +1,319 @@
+// Code generated by argsgen from args.txt; DO NOT EDIT.
+
+package strace
+
+// OpenArgs are the arguments of open
+type OpenArgs struct {
+	Path  string
+	Flags uint64
+	Mode  uint64
+}
+
+// OpenatArgs are the arguments of openat
+type OpenatArgs struct {
+	Dirfd int
+	Path  string
+	Flags uint64
+	Mode  uint64
+}
+
+// CloseArgs are the arguments of close
+type CloseArgs struct {
+	Fd int
+}
+
+// ReadArgs are the arguments of read
+type ReadArgs struct {
+	Fd    int
+	Buf   uintptr
+	Count uint64
+}
+
+// WriteArgs are the arguments of write
+type WriteArgs struct {
+	Fd    int
+	Buf   uintptr
+	Count uint64
+}
+
+// Pread64Args are the arguments of pread64
+type Pread64Args struct {
+	Fd     int
+	Buf    uintptr
+	Count  uint64
+	Offset int64
+}
+
+// Pwrite64Args are the arguments of pwrite64
+type Pwrite64Args struct {
+	Fd     int
+	Buf    uintptr
+	Count  uint64
+	Offset int64
+}
+
+// LseekArgs are the arguments of lseek
+type LseekArgs struct {
+	Fd     int
+	Offset int64
+	Whence int64
+}
+
+// Dup2Args are the arguments of dup2
+type Dup2Args struct {
+	OldFd int
+	NewFd int
+}
+
+// Dup3Args are the arguments of dup3
+type Dup3Args struct {
+	OldFd int
+	NewFd int
+	Flags uint64
+}
+
+// StatArgs are the arguments of stat
+type StatArgs struct {
+	Path string
+	Buf  uintptr
+}
+
+// LstatArgs are the arguments of lstat
+type LstatArgs struct {
+	Path string
+	Buf  uintptr
+}
+
+// NewfstatatArgs are the arguments of newfstatat
+type NewfstatatArgs struct {
+	Dirfd int
+	Path  string
+	Buf   uintptr
+	Flags uint64
+}
+
+// AccessArgs are the arguments of access
+type AccessArgs struct {
+	Path string
+	Mode uint64
+}
+
+// FaccessatArgs are the arguments of faccessat
+type FaccessatArgs struct {
+	Dirfd int
+	Path  string
+	Mode  uint64
+}
+
+// ReadlinkArgs are the arguments of readlink
+type ReadlinkArgs struct {
+	Path string
+	Buf  uintptr
+	Size uint64
+}
+
+// UnlinkArgs are the arguments of unlink
+type UnlinkArgs struct {
+	Path string
+}
+
+// UnlinkatArgs are the arguments of unlinkat
+type UnlinkatArgs struct {
+	Dirfd int
+	Path  string
+	Flags uint64
+}
+
+// MkdirArgs are the arguments of mkdir
+type MkdirArgs struct {
+	Path string
+	Mode uint64
+}
+
+// MkdiratArgs are the arguments of mkdirat
+type MkdiratArgs struct {
+	Dirfd int
+	Path  string
+	Mode  uint64
+}
+
+// RenameArgs are the arguments of rename
+type RenameArgs struct {
+	OldPath string
+	NewPath string
+}
+
+// Renameat2Args are the arguments of renameat2
+type Renameat2Args struct {
+	OldDirfd int
+	OldPath  string
+	NewDirfd int
+	NewPath  string
+	Flags    uint64
+}
+
+// ChdirArgs are the arguments of chdir
+type ChdirArgs struct {
+	Path string
+}
+
+// ChmodArgs are the arguments of chmod
+type ChmodArgs struct {
+	Path string
+	Mode uint64
+}
+
+// FchmodatArgs are the arguments of fchmodat
+type FchmodatArgs struct {
+	Dirfd int
+	Path  string
+	Mode  uint64
+}
+
+// TruncateArgs are the arguments of truncate
+type TruncateArgs struct {
+	Path   string
+	Length int64
+}
+
+// ExecveArgs are the arguments of execve
+type ExecveArgs struct {
+	Path string
+	Argv []string
+	Envp []string
+}
+
+// ExecveatArgs are the arguments of execveat
+type ExecveatArgs struct {
+	Dirfd int
+	Path  string
+	Argv  []string
+	Envp  []string
+	Flags uint64
+}
+
+// SocketArgs are the arguments of socket
+type SocketArgs struct {
+	Domain   int64
+	Type     int64
+	Protocol int64
+}
+
+// ConnectArgs are the arguments of connect
+type ConnectArgs struct {
+	Fd   int
+	Addr *SockAddr
+}
+
+// BindArgs are the arguments of bind
+type BindArgs struct {
+	Fd   int
+	Addr *SockAddr
+}
+
+// SendtoArgs are the arguments of sendto
+type SendtoArgs struct {
+	Fd    int
+	Buf   uintptr
+	Len   uint64
+	Flags uint64
+	Addr  *SockAddr
+}
+
+// KillArgs are the arguments of kill
+type KillArgs struct {
+	Pid int64
+	Sig int64
+}
+
+// MmapArgs are the arguments of mmap
+type MmapArgs struct {
+	Addr   uintptr
+	Length uint64
+	Prot   uint64
+	Flags  uint64
+	Fd     int
+	Offset int64
+}
+
+// MunmapArgs are the arguments of munmap
+type MunmapArgs struct {
+	Addr   uintptr
+	Length uint64
+}
+
+func decodeArgs(pid int, name string, args [6]uint64) any {
+	switch name {
+	case "open":
+		return &OpenArgs{Path: argPath(pid, args[0]), Flags: args[1], Mode: args[2]}
+	case "openat":
+		return &OpenatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Flags: args[2], Mode: args[3]}
+	case "close":
+		return &CloseArgs{Fd: argFd(args[0])}
+	case "read":
+		return &ReadArgs{Fd: argFd(args[0]), Buf: uintptr(args[1]), Count: args[2]}
+	case "write":
+		return &WriteArgs{Fd: argFd(args[0]), Buf: uintptr(args[1]), Count: args[2]}
+	case "pread64":
+		return &Pread64Args{Fd: argFd(args[0]), Buf: uintptr(args[1]), Count: args[2], Offset: int64(args[3])}
+	case "pwrite64":
+		return &Pwrite64Args{Fd: argFd(args[0]), Buf: uintptr(args[1]), Count: args[2], Offset: int64(args[3])}
+	case "lseek":
+		return &LseekArgs{Fd: argFd(args[0]), Offset: int64(args[1]), Whence: int64(args[2])}
+	case "dup2":
+		return &Dup2Args{OldFd: argFd(args[0]), NewFd: argFd(args[1])}
+	case "dup3":
+		return &Dup3Args{OldFd: argFd(args[0]), NewFd: argFd(args[1]), Flags: args[2]}
+	case "stat":
+		return &StatArgs{Path: argPath(pid, args[0]), Buf: uintptr(args[1])}
+	case "lstat":
+		return &LstatArgs{Path: argPath(pid, args[0]), Buf: uintptr(args[1])}
+	case "newfstatat":
+		return &NewfstatatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Buf: uintptr(args[2]), Flags: args[3]}
+	case "access":
+		return &AccessArgs{Path: argPath(pid, args[0]), Mode: args[1]}
+	case "faccessat":
+		return &FaccessatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Mode: args[2]}
+	case "readlink":
+		return &ReadlinkArgs{Path: argPath(pid, args[0]), Buf: uintptr(args[1]), Size: args[2]}
+	case "unlink":
+		return &UnlinkArgs{Path: argPath(pid, args[0])}
+	case "unlinkat":
+		return &UnlinkatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Flags: args[2]}
+	case "mkdir":
+		return &MkdirArgs{Path: argPath(pid, args[0]), Mode: args[1]}
+	case "mkdirat":
+		return &MkdiratArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Mode: args[2]}
+	case "rename":
+		return &RenameArgs{OldPath: argPath(pid, args[0]), NewPath: argPath(pid, args[1])}
+	case "renameat2":
+		return &Renameat2Args{OldDirfd: argFd(args[0]), OldPath: argPath(pid, args[1]), NewDirfd: argFd(args[2]), NewPath: argPath(pid, args[3]), Flags: args[4]}
+	case "chdir":
+		return &ChdirArgs{Path: argPath(pid, args[0])}
+	case "chmod":
+		return &ChmodArgs{Path: argPath(pid, args[0]), Mode: args[1]}
+	case "fchmodat":
+		return &FchmodatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Mode: args[2]}
+	case "truncate":
+		return &TruncateArgs{Path: argPath(pid, args[0]), Length: int64(args[1])}
+	case "execve":
+		return &ExecveArgs{Path: argPath(pid, args[0]), Argv: argStrings(pid, args[1]), Envp: argStrings(pid, args[2])}
+	case "execveat":
+		return &ExecveatArgs{Dirfd: argFd(args[0]), Path: argPath(pid, args[1]), Argv: argStrings(pid, args[2]), Envp: argStrings(pid, args[3]), Flags: args[4]}
+	case "socket":
+		return &SocketArgs{Domain: int64(args[0]), Type: int64(args[1]), Protocol: int64(args[2])}
+	case "connect":
+		return &ConnectArgs{Fd: argFd(args[0]), Addr: argSockaddr(pid, args[1], args[2])}
+	case "bind":
+		return &BindArgs{Fd: argFd(args[0]), Addr: argSockaddr(pid, args[1], args[2])}
+	case "sendto":
+		return &SendtoArgs{Fd: argFd(args[0]), Buf: uintptr(args[1]), Len: args[2], Flags: args[3], Addr: argSockaddr(pid, args[4], args[5])}
+	case "kill":
+		return &KillArgs{Pid: int64(args[0]), Sig: int64(args[1])}
+	case "mmap":
+		return &MmapArgs{Addr: uintptr(args[0]), Length: args[1], Prot: args[2], Flags: args[3], Fd: argFd(args[4]), Offset: int64(args[5])}
+	case "munmap":
+		return &MunmapArgs{Addr: uintptr(args[0]), Length: args[1]}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package strace
+
+import "sync"
+
+// Decoder decodes the arguments of a syscall pid just entered, like the ones generated from args.txt. it can
+// read the tracee's memory with PeekData and PeekString, nil means it has nothing for this call
+type Decoder func(pid int, args [6]uint64) any
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{}
+)
+
+// RegisterDecoder adds a decoder for a syscall, for niche syscalls or an ioctl space of your own, in front
+// of the built-in one if there is one. DecodeArgs and Options.DecodeArgs use it, a plugin for the strace
+// command registers its decoders from its init
+func RegisterDecoder(name string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[name] = d
+}
+
+// RegisteredDecoder is the decoder registered for a syscall, nil if there isn't one
+func RegisteredDecoder(name string) Decoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	return decoders[name]
+}
+
+// decode is the registered decoder's arguments, or the built-in ones if it has none
+func decode(pid int, name string, args [6]uint64) any {
+	if d := RegisteredDecoder(name); d != nil {
+		if v := d(pid, args); v != nil {
+			return v
+		}
+	}
+	return decodeArgs(pid, name, args)
+}
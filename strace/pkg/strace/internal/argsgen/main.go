@@ -0,0 +1,121 @@
+// argsgen turns the syscall schema in args.txt into args_gen.go: a struct of typed arguments per syscall,
+// and decodeArgs, which fills them in from a syscall's registers and the tracee's memory
+//
+//	go run ./internal/argsgen args.txt args_gen.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+// types and decoders of the kinds, %d is the argument's index, a sockaddr's second one is of its length
+var kinds = map[string]struct{ typ, decode string }{
+	"int":      {"int64", "int64(args[%d])"},
+	"uint":     {"uint64", "args[%d]"},
+	"fd":       {"int", "argFd(args[%d])"},
+	"ptr":      {"uintptr", "uintptr(args[%d])"},
+	"path":     {"string", "argPath(pid, args[%d])"},
+	"strings":  {"[]string", "argStrings(pid, args[%d])"},
+	"sockaddr": {"*SockAddr", "argSockaddr(pid, args[%d], args[%d])"},
+}
+
+type field struct {
+	name, kind string
+	arg        int
+}
+
+type syscallArgs struct {
+	name   string
+	fields []field
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf("usage: %s <schema> <output.go>", os.Args[0])
+	}
+	syscalls, err := parse(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(generate(os.Args[1], syscalls))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(os.Args[2], src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parse(path string) ([]syscallArgs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var syscalls []syscallArgs
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		words := strings.Fields(s.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		sc := syscallArgs{name: words[0]}
+		for arg, word := range words[1:] {
+			if word == "skip" {
+				continue
+			}
+			name, kind, ok := strings.Cut(word, ":")
+			if _, known := kinds[kind]; !ok || !known {
+				return nil, fmt.Errorf("%s:%d: bad argument %q, expected Name:kind", path, line, word)
+			}
+			if arg >= 6 || (kind == "sockaddr" && arg >= 5) {
+				return nil, fmt.Errorf("%s:%d: %s has more than 6 arguments", path, line, sc.name)
+			}
+			sc.fields = append(sc.fields, field{name, kind, arg})
+		}
+		syscalls = append(syscalls, sc)
+	}
+	return syscalls, s.Err()
+}
+
+func generate(schema string, syscalls []syscallArgs) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by argsgen from %s; DO NOT EDIT.\n\npackage strace\n\n", schema)
+	for _, sc := range syscalls {
+		fmt.Fprintf(&b, "// %s are the arguments of %s\ntype %[1]s struct {\n", structName(sc.name), sc.name)
+		for _, f := range sc.fields {
+			fmt.Fprintf(&b, "\t%s %s\n", f.name, kinds[f.kind].typ)
+		}
+		fmt.Fprintf(&b, "}\n\n")
+	}
+
+	fmt.Fprintf(&b, "func decodeArgs(pid int, name string, args [6]uint64) any {\n\tswitch name {\n")
+	for _, sc := range syscalls {
+		fmt.Fprintf(&b, "\tcase %q:\n\t\treturn &%s{", sc.name, structName(sc.name))
+		for i, f := range sc.fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			decode := fmt.Sprintf(kinds[f.kind].decode, f.arg)
+			if f.kind == "sockaddr" {
+				decode = fmt.Sprintf(kinds[f.kind].decode, f.arg, f.arg+1)
+			}
+			fmt.Fprintf(&b, "%s: %s", f.name, decode)
+		}
+		fmt.Fprintf(&b, "}\n")
+	}
+	fmt.Fprintf(&b, "\t}\n\treturn nil\n}\n")
+	return b.Bytes()
+}
+
+// structName is OpenatArgs for openat
+func structName(syscall string) string {
+	return strings.ToUpper(syscall[:1]) + syscall[1:] + "Args"
+}
@@ -0,0 +1,64 @@
+package strace
+
+import (
+	"syscall"
+)
+
+// pidfds (linux 5.3) refer to a process rather than a pid, so a signal sent through one can't hit another
+// process that got the pid after ours exited and was reaped. they're the same on every arch
+const (
+	sysPidfdSendSignal = 424
+	sysPidfdOpen       = 434
+	sysPidfdGetfd      = 438
+)
+
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	syscall.CloseOnExec(int(fd))
+	return int(fd), nil
+}
+
+func pidfdSendSignal(fd int, sig syscall.Signal) error {
+	_, _, errno := syscall.Syscall6(sysPidfdSendSignal, uintptr(fd), uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// GetFd copies the fd of process pid into ours with pidfd_getfd (linux 5.6), to look at a socket or file the
+// way the tracee has it open. the copy is the caller's to close
+func GetFd(pid, fd int) (int, error) {
+	pidfd, err := pidfdOpen(pid)
+	if err != nil {
+		return -1, err
+	}
+	defer syscall.Close(pidfd)
+
+	local, _, errno := syscall.Syscall(sysPidfdGetfd, uintptr(pidfd), uintptr(fd), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	syscall.CloseOnExec(int(local))
+	return int(local), nil
+}
+
+// PidFD is a pidfd of the main tracee, to poll for it exiting (it's readable then) or to signal it without
+// racing with the pid being reused. it's -1 before Run or Attach, after they return, and on kernels
+// without pidfds. the Tracer owns it, so it mustn't be closed
+func (t *Tracer) PidFD() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pidfd
+}
+
+// signal sends sig to the main tracee, through its pidfd when there is one
+func (t *Tracer) signal(sig syscall.Signal) error {
+	if t.pidfd >= 0 {
+		return pidfdSendSignal(t.pidfd, sig)
+	}
+	return syscall.Kill(t.pid, sig)
+}
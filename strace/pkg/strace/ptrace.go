@@ -0,0 +1,171 @@
+package strace
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// requests the syscall package doesn't have
+const (
+	ptraceGetSigInfo     = 0x4202
+	ptraceSeize          = 0x4206
+	ptraceInterrupt      = 0x4207
+	ptraceListen         = 0x4208
+	ptraceGetSyscallInfo = 0x420e
+
+	ptraceEventStop = 128
+
+	prSetChildSubreaper = 36
+	prGetChildSubreaper = 37
+
+	ptraceSyscallInfoEntry = 1
+	ptraceSyscallInfoExit  = 2
+)
+
+type stopKind int
+
+// a tracee in a ptrace stop is in one of these, told apart by the wait status
+const (
+	syscallStop stopKind = iota // entering or leaving a syscall
+	eventStop                   // a PTRACE_EVENT_* stop, like a fork or an exec
+	groupStop                   // stopped by SIGSTOP, SIGTSTP and the like
+	signalStop                  // a signal is about to be delivered to it
+)
+
+// classifyStop works out what stopped a tracee. syscall stops are SIGTRAP|0x80 with PTRACE_O_TRACESYSGOOD
+// and events have the event in the status' high byte. a group stop of a seized tracee is a PTRACE_EVENT_STOP
+// with the stopping signal, one of a tracee that wasn't seized looks like a signal stop except that there's
+// no siginfo for it
+func classifyStop(tid int, status syscall.WaitStatus) stopKind {
+	stopping := false
+	switch status.StopSignal() {
+	case syscall.SIGTRAP | 0x80:
+		return syscallStop
+	case syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		stopping = true
+	}
+	switch event := stopEvent(status); {
+	case event == ptraceEventStop && stopping:
+		return groupStop
+	case event != 0:
+		return eventStop
+	}
+	if stopping {
+		var siginfo [128]byte
+		if ptrace(ptraceGetSigInfo, tid, 0, uintptr(unsafe.Pointer(&siginfo[0]))) == syscall.EINVAL {
+			return groupStop
+		}
+	}
+	return signalStop
+}
+
+// stopEvent is the PTRACE_EVENT_* of an event stop, 0 for other stops
+func stopEvent(status syscall.WaitStatus) int {
+	return int(uint32(status)>>16) & 0xff
+}
+
+// syscallStage asks the kernel whether a tracee in a syscall stop is entering or leaving it,
+// ok is false on kernels before 5.3 where the stops have to be counted instead
+func syscallStage(tid int) (stage Stage, ok bool) {
+	var op [1]byte // the first field of struct ptrace_syscall_info, the kernel copies as much as we ask for
+	if err := ptrace(ptraceGetSyscallInfo, tid, uintptr(len(op)), uintptr(unsafe.Pointer(&op[0]))); err != nil {
+		return 0, false
+	}
+	switch op[0] {
+	case ptraceSyscallInfoEntry:
+		return Enter, true
+	case ptraceSyscallInfoExit:
+		return Exit, true
+	}
+	return 0, false
+}
+
+func ptrace(request int, pid int, addr, data uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(request), uintptr(pid), addr, data, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// seize attaches to a running process with PTRACE_SEIZE, which unlike PTRACE_ATTACH doesn't send it a SIGSTOP,
+// then interrupts it so it sits in a stop we can start syscall tracing from
+func seize(pid int) error {
+	if err := ptrace(ptraceSeize, pid, 0, 0); err != nil {
+		return fmt.Errorf("seizing %d: %w", pid, err)
+	}
+	if err := ptrace(ptraceInterrupt, pid, 0, 0); err != nil {
+		return fmt.Errorf("interrupting %d: %w", pid, err)
+	}
+	if _, err := syscall.Wait4(pid, nil, syscall.WALL, nil); err != nil {
+		return fmt.Errorf("waiting for %d to stop: %w", pid, err)
+	}
+	return nil
+}
+
+// becomeSubreaper sets PR_SET_CHILD_SUBREAPER on this process, restore puts back what it was
+func becomeSubreaper() (restore func(), err error) {
+	var was int32
+	syscall.RawSyscall(syscall.SYS_PRCTL, prGetChildSubreaper, uintptr(unsafe.Pointer(&was)), 0)
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return nil, errno
+	}
+	return func() { syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, uintptr(was), 0) }, nil
+}
+
+// tkill sends sig to a single thread
+func tkill(tid int, sig syscall.Signal) {
+	syscall.Syscall(syscall.SYS_TKILL, uintptr(tid), uintptr(sig), 0)
+}
+
+// PeekData reads n bytes at addr from the tracee's memory, it can only be used from an OnSyscall callback.
+// when only the start of them is mapped, that much is returned with the error
+func PeekData(pid int, addr uintptr, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := syscall.PtracePeekData(pid, addr, buf)
+	return buf[:read], err
+}
+
+// PeekString reads a NUL terminated string of at most max bytes at addr from the tracee's memory,
+// like PeekData it can only be used from an OnSyscall callback, and returns what it could read with an error
+func PeekString(pid int, addr uintptr, max int) (string, error) {
+	var s []byte
+	for len(s) < max {
+		// small chunks that don't cross a page, the string might end right before an unmapped one
+		n := 256
+		if left := 4096 - int(addr%4096); n > left {
+			n = left
+		}
+		if n > max-len(s) {
+			n = max - len(s)
+		}
+		b, err := PeekData(pid, addr, n)
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return string(append(s, b[:i]...)), nil
+		}
+		s = append(s, b...)
+		if err != nil {
+			return string(s), err
+		}
+		addr += uintptr(n)
+	}
+	return string(s), nil
+}
+
+// Fail makes the syscall pid just entered fail with errno without running it, it can only be used from an
+// OnSyscall callback on Enter. the Exit event reports the failure
+func (t *Tracer) Fail(pid int, errno syscall.Errno) error {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return err
+	}
+	nr := regs.Orig_rax
+	regs.Orig_rax = ^uint64(0) // no such syscall, so the kernel skips it
+	if err := syscall.PtraceSetRegs(pid, &regs); err != nil {
+		return err
+	}
+	t.failing[pid] = failure{nr, errno}
+	return nil
+}
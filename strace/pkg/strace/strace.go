@@ -0,0 +1,619 @@
+// Package strace traces the syscalls of a process with ptrace, calling back into the caller on every syscall stop.
+//
+// ptrace requests have to come from the thread that attached to the tracee, so Run and Attach lock the calling
+// goroutine to its thread and the whole trace, callbacks included, happens on that goroutine
+package strace
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	seccomp "github.com/seccomp/libseccomp-golang"
+)
+
+type Stage int
+
+const (
+	Enter Stage = iota
+	Exit
+)
+
+func (s Stage) String() string {
+	if s == Enter {
+		return "enter"
+	}
+	return "exit"
+}
+
+// SyscallEvent is a single syscall stop. Args are only meaningful on Enter, RetVal and Duration on Exit,
+// consumers that need both match an Exit with the preceding Enter of the same pid, or use Options.Paired
+type SyscallEvent struct {
+	PID      int
+	Stage    Stage
+	Nr       uint64
+	Name     string
+	Args     [6]uint64
+	IP       uint64 // where the tracee made the syscall from, just past its syscall instruction
+	Decoded  any    // with Options.DecodeArgs, the typed Args of an Enter, like *OpenatArgs, nil for unknown syscalls
+	RetVal   int64
+	Duration time.Duration // since the matching Enter
+	Time     time.Time
+}
+
+// Failed reports whether an Exit event returned an error
+func (e SyscallEvent) Failed() bool {
+	return e.RetVal < 0 && e.RetVal > -4096
+}
+
+type ProcessEventKind int
+
+const (
+	Started ProcessEventKind = iota // a new process or thread, from a fork, vfork or clone of a tracee
+	Exec                            // a tracee successfully executed a new program
+	Exited                          // a tracee exited or was killed
+)
+
+// ProcessEvent is a change in the set of traced processes, only reported with Follow
+// (except for Exec and the main tracee's Exited)
+type ProcessEvent struct {
+	Kind   ProcessEventKind
+	PID    int
+	Parent int                // Started only
+	Status syscall.WaitStatus // Exited only
+	Time   time.Time
+}
+
+type Options struct {
+	// OnSyscall is called for every syscall enter and exit. the tracee stays stopped until it returns,
+	// and helpers that use ptrace, like PeekData, only work from inside it
+	OnSyscall func(SyscallEvent)
+
+	// Follow traces the children and threads of the tracee too, like strace -f
+	Follow bool
+	// OnProcess is called when tracees come and go, from the tracing goroutine like OnSyscall
+	OnProcess func(ProcessEvent)
+
+	// Sample only traces this fraction of the time, eg 0.01, in windows of SampleWindow, 0 traces everything.
+	// in between the tracees run without syscall stops, which is where the overhead of tracing is
+	Sample float64
+
+	// Subreaper makes Run's process the subreaper of the command with Follow, its orphaned descendants, like a
+	// daemon that double forked, are reparented to it instead of init. they're traced either way, but this way
+	// the trace is their parent to the end and their zombies are reaped here. a daemon that waits for getppid()
+	// to be 1 waits forever with it
+	Subreaper bool
+
+	// DecodeArgs fills in SyscallEvent.Decoded, reading paths, argv and addresses from the tracee while
+	// it's stopped, so consumers of Events get them too
+	DecodeArgs bool
+
+	// Paired reports every syscall once, as its Exit with the Args, IP and Decoded of its Enter in it too, so
+	// OnSyscall and Events get whole syscalls. one that never returns, like exit_group, or one its tracee
+	// is killed in the middle of, comes as just its Enter when the tracee exits
+	Paired bool
+}
+
+// SampleWindow is how long each sampled stretch of tracing lasts
+const SampleWindow = 10 * time.Millisecond
+
+// Result is how the trace ended
+type Result struct {
+	Pid      int
+	Detached bool               // the tracee is still running
+	Status   syscall.WaitStatus // final status of the tracee, if it didn't get detached
+	Rusage   syscall.Rusage
+}
+
+type Tracer struct {
+	opts Options
+
+	mu     sync.Mutex
+	pid    int
+	pidfd  int          // of pid, -1 if there's none
+	traced map[int]bool // every tracee, so Detach can wake them all
+	paused map[int]bool // tracees running without syscall stops until the next sample or Resume
+	killed bool         // Kill was called, tracees that show up later are killed too
+	off    bool         // between samples
+	held   bool         // between Pause and Resume
+
+	detach     chan struct{}
+	detachOnce sync.Once
+
+	events chan SyscallEvent
+
+	failing map[int]failure // tracees skipping the syscall they entered, only used from the tracing goroutine
+}
+
+type failure struct {
+	nr    uint64
+	errno syscall.Errno
+}
+
+func New(opts Options) *Tracer {
+	return &Tracer{opts: opts, pidfd: -1, detach: make(chan struct{}), traced: map[int]bool{}, paused: map[int]bool{}, failing: map[int]failure{}}
+}
+
+// Events returns a channel that receives every syscall event, and is closed when the trace ends.
+// it has to be called before Run or Attach, and has to be drained, since the tracee is kept stopped
+// while the channel's buffer is full
+func (t *Tracer) Events() <-chan SyscallEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.events == nil {
+		t.events = make(chan SyscallEvent, 256)
+	}
+	return t.events
+}
+
+// Run starts cmd and traces it until it exits or Detach is called
+func (t *Tracer) Run(cmd *exec.Cmd) (*Result, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	if t.opts.Follow && t.opts.Subreaper {
+		restore, err := becomeSubreaper()
+		if err != nil {
+			return nil, fmt.Errorf("becoming a subreaper: %w", err)
+		}
+		defer restore()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	pid := cmd.Process.Pid
+	t.setPid(pid)
+	defer t.closePid()
+
+	// the tracee starts out stopped by the SIGTRAP following execve
+	if _, err := syscall.Wait4(pid, nil, 0, nil); err != nil {
+		return nil, fmt.Errorf("waiting for %d to start: %w", pid, err)
+	}
+
+	res, err := t.trace(pid)
+	if err == nil && !res.Detached {
+		// we already reaped the tracee, this only waits for cmd's output copying goroutines
+		cmd.Wait()
+	}
+	return res, err
+}
+
+// Attach traces an already running process until it exits or Detach is called
+func (t *Tracer) Attach(pid int) (*Result, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := seize(pid); err != nil {
+		return nil, err
+	}
+	t.setPid(pid)
+	defer t.closePid()
+
+	// the process may already have more threads, which are tracees of their own
+	var threads []int
+	if t.opts.Follow {
+		tids, _ := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+		for _, tid := range tids {
+			if tid, err := strconv.Atoi(tid.Name()); err == nil && tid != pid && seize(tid) == nil {
+				threads = append(threads, tid)
+			}
+		}
+	}
+	return t.trace(pid, threads...)
+}
+
+// Detach stops tracing at the next stop and leaves the tracees running, it's safe to call from any goroutine.
+// only the tracing thread can make ptrace requests and it's usually blocked waiting for a tracee,
+// so every tracee is sent wakeSignal to force a stop
+func (t *Tracer) Detach() {
+	t.detachOnce.Do(func() {
+		close(t.detach)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for tid := range t.traced {
+			t.wakeTracee(tid)
+		}
+	})
+}
+
+// Kill sends SIGKILL to every tracee, with Follow that's the whole process tree. the trace ends once they're
+// gone, with the main tracee's status. it's safe to call from any goroutine
+func (t *Tracer) Kill() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.killed = true
+	// a tracee is only reaped by our wait, but that can be right before it's untracked with its pid free
+	// again, so the main one is signaled through its pidfd. the others can be threads, which it can't refer to
+	for tid := range t.traced {
+		if tid == t.pid {
+			t.signal(syscall.SIGKILL)
+		} else {
+			syscall.Kill(tid, syscall.SIGKILL)
+		}
+	}
+}
+
+// wakeSignal is ignored by default and suppressed when we detach or start a sample, so the tracee never
+// sees it. a real one that arrives while a tracee is paused is lost, which for a Go program just means a
+// goroutine is preempted a bit later
+const wakeSignal = syscall.SIGURG
+
+// wNoThread (__WNOTHREAD) only waits for the tracees of the calling thread, so several Tracers can run in
+// one process, each on its own thread, without taking each other's stops when Follow waits for any child
+const wNoThread = 0x20000000
+
+// sample alternates between tracing for SampleWindow and letting the tracees run free, until done is closed.
+// a tracee is paused at its first syscall exit after a window ends, and woken with wakeSignal when the next starts
+func (t *Tracer) sample(done chan struct{}) {
+	off := time.Duration(float64(SampleWindow) * (1/t.opts.Sample - 1))
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(SampleWindow):
+		}
+		t.mu.Lock()
+		t.off = true
+		t.mu.Unlock()
+
+		select {
+		case <-done:
+			return
+		case <-time.After(off):
+		}
+		t.mu.Lock()
+		t.off = false
+		if !t.held {
+			t.wakeAll()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Pause lets the tracees run without syscall stops, so without events, until Resume. each one goes on
+// without them from its next syscall exit. it's safe to call from any goroutine
+func (t *Tracer) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held = true
+}
+
+// Resume traces syscalls again after Pause, unless it's between samples
+func (t *Tracer) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held = false
+	if !t.off {
+		t.wakeAll()
+	}
+}
+
+// wakeAll gets the paused tracees to stop so they're traced again, t.mu has to be held
+func (t *Tracer) wakeAll() {
+	for tid := range t.paused {
+		t.wakeTracee(tid)
+	}
+}
+
+// wakeTracee sends wakeSignal to a tracee, like Kill the main one through its pidfd so the pid can't have
+// been reused. that signal is for the whole process, which the kernel gives to the main thread first
+func (t *Tracer) wakeTracee(tid int) {
+	if tid == t.pid {
+		t.signal(wakeSignal)
+	} else {
+		tkill(tid, wakeSignal)
+	}
+}
+
+// pause stops syscall stops for a tracee that just exited a syscall, if we're between samples or held
+func (t *Tracer) pause(tid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.off || t.held {
+		t.paused[tid] = true
+	}
+}
+
+// wake starts the next sample for a paused tracee, false if it wasn't paused
+func (t *Tracer) wake(tid int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused[tid] {
+		return false
+	}
+	delete(t.paused, tid)
+	return true
+}
+
+// resume continues a tracee to its next syscall stop, or without any if it's paused between samples
+func (t *Tracer) resume(tid, sig int) {
+	t.mu.Lock()
+	paused := t.paused[tid]
+	t.mu.Unlock()
+	if paused {
+		syscall.PtraceCont(tid, sig)
+	} else {
+		syscall.PtraceSyscall(tid, sig)
+	}
+}
+
+// setPid sets the main tracee, with the pidfd it's signaled through until closePid
+func (t *Tracer) setPid(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pid = pid
+	if fd, err := pidfdOpen(pid); err == nil {
+		t.pidfd = fd
+	}
+}
+
+func (t *Tracer) closePid() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pidfd >= 0 {
+		syscall.Close(t.pidfd)
+		t.pidfd = -1
+	}
+}
+
+// track adds or removes a tracee, a tracee added after Detach is woken right away
+func (t *Tracer) track(tid int, traced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !traced {
+		delete(t.traced, tid)
+		delete(t.paused, tid)
+		return
+	}
+	t.traced[tid] = true
+	if t.killed {
+		syscall.Kill(tid, syscall.SIGKILL)
+	}
+	select {
+	case <-t.detach:
+		tkill(tid, wakeSignal)
+	default:
+	}
+}
+
+func (t *Tracer) process(e ProcessEvent) {
+	if t.opts.OnProcess != nil {
+		t.opts.OnProcess(e)
+	}
+}
+
+// tracee is the state of a single traced thread
+type tracee struct {
+	stage     Stage // where the next syscall stop is, if the kernel is too old to have PTRACE_GET_SYSCALL_INFO say
+	enterTime time.Time
+	entered   *SyscallEvent // with Paired, the Enter its Exit is still to come for
+	started   bool          // seen its first stop, a new tracee starts with a SIGSTOP that isn't meant for it
+}
+
+// trace runs the syscall loop on tracees that are in a ptrace stop, pid is the main one whose exit ends the trace
+// without Follow, and whose status and rusage end up in the Result
+func (t *Tracer) trace(pid int, threads ...int) (*Result, error) {
+	res := &Result{Pid: pid}
+
+	t.mu.Lock()
+	events := t.events
+	t.mu.Unlock()
+	if events != nil {
+		defer close(events)
+	}
+
+	// mark syscall stops so they can't be mistaken for a SIGTRAP, report the stop after a successful execve
+	// as an event, and with Follow have new children and threads traced from their first instruction
+	options := syscall.PTRACE_O_TRACESYSGOOD | syscall.PTRACE_O_TRACEEXEC
+	waitFor := pid
+	if t.opts.Follow {
+		options |= syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK | syscall.PTRACE_O_TRACECLONE
+		waitFor = -1
+	}
+
+	// the current stops (after execve, or our interrupt when attaching) aren't syscall stops, so move past them
+	tracees := map[int]*tracee{}
+	for _, tid := range append([]int{pid}, threads...) {
+		tracees[tid] = &tracee{started: true}
+		t.track(tid, true)
+		syscall.PtraceSetOptions(tid, options)
+		syscall.PtraceSyscall(tid, 0)
+	}
+	defer func() {
+		for tid := range tracees {
+			t.track(tid, false)
+		}
+	}()
+
+	emit := func(e SyscallEvent) {
+		if t.opts.OnSyscall != nil {
+			t.opts.OnSyscall(e)
+		}
+		if events != nil {
+			events <- e
+		}
+	}
+
+	if t.opts.Sample > 0 && t.opts.Sample < 1 {
+		done := make(chan struct{})
+		defer close(done)
+		go t.sample(done)
+	}
+
+	for len(tracees) > 0 {
+		var status syscall.WaitStatus
+		var rusage syscall.Rusage
+		tid, err := syscall.Wait4(waitFor, &status, syscall.WALL|wNoThread, &rusage)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		now := time.Now()
+
+		if status.Exited() || status.Signaled() {
+			if _, ok := tracees[tid]; !ok && tid != pid {
+				// a zombie reparented to us as its subreaper, its exit as a tracee was reported already
+				continue
+			}
+			if tr, ok := tracees[tid]; ok && tr.entered != nil {
+				emit(*tr.entered)
+			}
+			delete(tracees, tid)
+			delete(t.failing, tid)
+			t.track(tid, false)
+			if tid == pid {
+				res.Status, res.Rusage = status, rusage
+			}
+			t.process(ProcessEvent{Kind: Exited, PID: tid, Status: status, Time: now})
+			continue
+		}
+		if !status.Stopped() {
+			continue
+		}
+
+		tr, ok := tracees[tid]
+		if !ok {
+			// a new child can report its first stop before its parent reports the fork
+			tr = &tracee{}
+			tracees[tid] = tr
+			t.track(tid, true)
+		}
+
+		select {
+		case <-t.detach:
+			if err := syscall.PtraceDetach(tid); err != nil && err != syscall.ESRCH {
+				return res, err
+			}
+			delete(tracees, tid)
+			t.track(tid, false)
+			res.Detached = true
+			continue
+		default:
+		}
+
+		switch classifyStop(tid, status) {
+		case eventStop:
+			switch stopEvent(status) {
+			case syscall.PTRACE_EVENT_FORK, syscall.PTRACE_EVENT_VFORK, syscall.PTRACE_EVENT_CLONE:
+				if msg, err := syscall.PtraceGetEventMsg(tid); err == nil {
+					child := int(msg)
+					if _, ok := tracees[child]; !ok {
+						tracees[child] = &tracee{}
+						t.track(child, true)
+					}
+					t.process(ProcessEvent{Kind: Started, PID: child, Parent: tid, Time: now})
+				}
+			case syscall.PTRACE_EVENT_EXEC:
+				// the exec's syscall exit stop is still to come
+				t.process(ProcessEvent{Kind: Exec, PID: tid, Time: now})
+			case ptraceEventStop:
+				// children of a seized tracee start with this instead of a SIGSTOP, and a listening tracee
+				// reports it when a SIGCONT ends its group stop
+			}
+			tr.started = true
+			t.resume(tid, 0)
+			continue
+		case groupStop:
+			tr.started = true
+			if stopEvent(status) == ptraceEventStop {
+				// seized, listen keeps it stopped until a SIGCONT but still reports the signals it gets
+				ptrace(ptraceListen, tid, 0, 0)
+				continue
+			}
+			// a tracee that wasn't seized can't be kept in its group stop for us to still get its syscalls,
+			// so like strace it's let go on, and ignores the stop
+			t.resume(tid, 0)
+			continue
+		case signalStop:
+			// a signal is about to be delivered, pass it on unless it's one of ours
+			sig := int(status.StopSignal())
+			if !tr.started && status.StopSignal() == syscall.SIGSTOP {
+				sig = 0
+			}
+			if status.StopSignal() == wakeSignal && t.wake(tid) {
+				sig = 0
+			}
+			tr.started = true
+			t.resume(tid, sig)
+			continue
+		}
+		tr.started = true
+		if stage, ok := syscallStage(tid); ok {
+			tr.stage = stage
+		}
+
+		var regs syscall.PtraceRegs
+		err = syscall.PtraceGetRegs(tid, &regs)
+		if err == syscall.ESRCH {
+			// killed while stopped, its exit is still to be waited for
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+
+		if f, ok := t.failing[tid]; ok && tr.stage == Exit {
+			// the kernel skipped it and returned ENOSYS, make that the errno we were asked for
+			delete(t.failing, tid)
+			regs.Rax = uint64(-int64(f.errno))
+			if err := syscall.PtraceSetRegs(tid, &regs); err != nil {
+				return res, err
+			}
+			regs.Orig_rax = f.nr
+		}
+
+		name, _ := seccomp.ScmpSyscall(regs.Orig_rax).GetName() // no-lib alternative would be to create a arch-dependent map[code]name
+
+		e := SyscallEvent{
+			PID:   tid,
+			Stage: tr.stage,
+			Nr:    regs.Orig_rax,
+			Name:  name,
+			IP:    regs.Rip,
+			Time:  now,
+		}
+		if tr.stage == Enter {
+			e.Args = [6]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10, regs.R8, regs.R9}
+			if t.opts.DecodeArgs {
+				e.Decoded = decode(tid, name, e.Args)
+			}
+			tr.enterTime = now
+			tr.stage = Exit
+		} else {
+			e.RetVal = int64(regs.Rax)
+			e.Duration = now.Sub(tr.enterTime)
+			tr.stage = Enter
+			if tr.entered != nil {
+				e.Args, e.IP, e.Decoded = tr.entered.Args, tr.entered.IP, tr.entered.Decoded
+				tr.entered = nil
+			}
+		}
+
+		if t.opts.Paired && e.Stage == Enter {
+			tr.entered = &e
+		} else {
+			emit(e)
+		}
+
+		// continue to the next syscall enter or exit, or with sampling past the end of a window, to the next one
+		if tr.stage == Enter {
+			t.pause(tid)
+		}
+		t.resume(tid, 0)
+	}
+
+	return res, nil
+}
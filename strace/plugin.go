@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// plugins are -plugin flags, go plugins (go build -buildmode=plugin) that add decoders for the syscalls or
+// ioctls they know with strace.RegisterDecoder from their init. the calls they decode are printed with what
+// the decoder returned, through its String method if it has one
+type plugins []string
+
+func (p *plugins) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *plugins) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// load opens every plugin, which runs its init
+func (p plugins) load() error {
+	for _, path := range p {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading plugin %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pluginArgs are the arguments of a call as a registered decoder has them, ok is false for the calls no plugin
+// decodes, and with -s 0, since decoders read the tracee's memory
+func pluginArgs(pid int, name string, args [6]uint64) (string, bool) {
+	d := strace.RegisteredDecoder(name)
+	if d == nil || *stringLimit == 0 {
+		return "", false
+	}
+	v := d(pid, args)
+	if v == nil {
+		return "", false
+	}
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	return fmt.Sprintf("%+v", v), true
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// procName is the command name of a running process
+func procName(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return fmt.Sprint(pid)
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"sort"
+)
+
+// seccompProfile collects every syscall the tracee made, filters or not, for -emit-seccomp: an OCI seccomp
+// profile, the format docker, podman and runc take, that allows exactly those and fails anything else with EPERM
+type seccompProfile struct {
+	names map[string]bool
+}
+
+type ociSeccomp struct {
+	DefaultAction   string           `json:"defaultAction"`
+	DefaultErrnoRet int              `json:"defaultErrnoRet"`
+	Architectures   []string         `json:"architectures"`
+	Syscalls        []ociSyscallRule `json:"syscalls"`
+}
+
+type ociSyscallRule struct {
+	Names  []string `json:"names"`
+	Action string   `json:"action"`
+}
+
+// the architectures a profile applies to, by GOARCH, with the compat ones the kernel runs on the same host
+var seccompArchs = map[string][]string{
+	"amd64": {"SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"},
+	"arm64": {"SCMP_ARCH_AARCH64", "SCMP_ARCH_ARM"},
+}
+
+func newSeccompProfile() *seccompProfile {
+	// the runtime puts the profile in place before it execs the command, an exec we don't see traced
+	return &seccompProfile{names: map[string]bool{"execve": true}}
+}
+
+func (p *seccompProfile) enter(name string) {
+	// syscalls libseccomp can't name wouldn't be in the profile under any name anyway
+	if name != "" {
+		p.names[name] = true
+	}
+}
+
+func (p *seccompProfile) write(path string) error {
+	names := make([]string, 0, len(p.names))
+	for name := range p.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ociSeccomp{
+		DefaultAction:   "SCMP_ACT_ERRNO",
+		DefaultErrnoRet: 1, // EPERM
+		Architectures:   seccompArchs[runtime.GOARCH],
+		Syscalls:        []ociSyscallRule{{Names: names, Action: "SCMP_ACT_ALLOW"}},
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// readinessDecoder renders the calls event loops are made of, epoll, poll and inotify, with the fds and events
+// behind their pointers. epoll hands back whatever data the program registered, which is usually the fd but
+// doesn't have to be, so registrations are remembered to name the fd anyway
+type readinessDecoder struct {
+	tgids   threadGroups
+	epoll   map[epollKey]int      // registered data -> fd
+	inotify map[fdKey]bool        // inotify instances
+	watches map[inotifyKey]string // watch descriptor -> path
+}
+
+type fdKey struct {
+	tgid, fd int
+}
+
+type epollKey struct {
+	tgid, epfd int
+	data       uint64
+}
+
+type inotifyKey struct {
+	tgid, fd, wd int
+}
+
+type flagName struct {
+	bit  uint32
+	name string
+}
+
+var pollEvents = []flagName{
+	{0x1, "IN"}, {0x2, "PRI"}, {0x4, "OUT"}, {0x8, "ERR"}, {0x10, "HUP"}, {0x20, "NVAL"},
+	{0x40, "RDNORM"}, {0x80, "RDBAND"}, {0x100, "WRNORM"}, {0x200, "WRBAND"}, {0x400, "MSG"}, {0x2000, "RDHUP"},
+	{1 << 28, "EXCLUSIVE"}, {1 << 29, "WAKEUP"}, {1 << 30, "ONESHOT"}, {1 << 31, "ET"},
+}
+
+var inotifyEvents = []flagName{
+	{0x1, "ACCESS"}, {0x2, "MODIFY"}, {0x4, "ATTRIB"}, {0x8, "CLOSE_WRITE"}, {0x10, "CLOSE_NOWRITE"},
+	{0x20, "OPEN"}, {0x40, "MOVED_FROM"}, {0x80, "MOVED_TO"}, {0x100, "CREATE"}, {0x200, "DELETE"},
+	{0x400, "DELETE_SELF"}, {0x800, "MOVE_SELF"}, {0x2000, "UNMOUNT"}, {0x4000, "Q_OVERFLOW"},
+	{0x8000, "IGNORED"}, {0x40000000, "ISDIR"},
+}
+
+var epollOps = map[uint64]string{1: "ADD", 2: "DEL", 3: "MOD"}
+
+const (
+	epollEventSize   = 12 // struct epoll_event is packed on x86_64
+	pollFdSize       = 8
+	inotifyEventSize = 16
+
+	// how many fds of one call are rendered
+	readinessMaxFds = 64
+)
+
+func newReadinessDecoder() *readinessDecoder {
+	return &readinessDecoder{
+		tgids:   threadGroups{},
+		epoll:   map[epollKey]int{},
+		inotify: map[fdKey]bool{},
+		watches: map[inotifyKey]string{},
+	}
+}
+
+// describeFlags names the bits of v, a flag of several bits only when they're all set, so those have to
+// come before the single bits they're made of
+func describeFlags(names []flagName, v uint32) string {
+	var s []string
+	for _, f := range names {
+		if v&f.bit == f.bit {
+			s = append(s, f.name)
+			v &^= f.bit
+		}
+	}
+	if v != 0 || len(s) == 0 {
+		s = append(s, fmt.Sprintf("%#x", v))
+	}
+	return strings.Join(s, "|")
+}
+
+// exit decodes a syscall that just returned, given its entry args, ok is false for everything else
+func (r *readinessDecoder) exit(pid int, name string, args [6]uint64, ret int64) (line string, ok bool) {
+	tgid := r.tgids.of(pid)
+	failed := ret < 0 && ret > -4096
+
+	switch name {
+	case "epoll_ctl":
+		epfd, fd := int(int32(args[0])), int(int32(args[2]))
+		op, ok := epollOps[args[1]]
+		if !ok {
+			op = fmt.Sprint(args[1])
+		}
+		var events uint32
+		var data uint64
+		if b, err := strace.PeekData(pid, uintptr(args[3]), epollEventSize); err == nil && len(b) == epollEventSize {
+			events, data = binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint64(b[4:])
+		}
+		if !failed {
+			switch op {
+			case "ADD", "MOD":
+				r.epoll[epollKey{tgid, epfd, data}] = fd
+			case "DEL":
+				for k, v := range r.epoll {
+					if k.tgid == tgid && k.epfd == epfd && v == fd {
+						delete(r.epoll, k)
+					}
+				}
+			}
+		}
+		if op == "DEL" {
+			return fmt.Sprintf("epoll_ctl(%d, DEL, fd %d) = %d", epfd, fd, ret), true
+		}
+		return fmt.Sprintf("epoll_ctl(%d, %s, fd %d, %s, data=%#x) = %d", epfd, op, fd, describeFlags(pollEvents, events), data, ret), true
+
+	case "epoll_wait", "epoll_pwait", "epoll_pwait2":
+		epfd := int(int32(args[0]))
+		if failed || ret == 0 {
+			return fmt.Sprintf("%s(%d) = %d", name, epfd, ret), true
+		}
+		n := int(min64(uint64(ret), readinessMaxFds))
+		b, err := strace.PeekData(pid, uintptr(args[1]), n*epollEventSize)
+		if err != nil {
+			return fmt.Sprintf("%s(%d) = %d", name, epfd, ret), true
+		}
+		var fired []string
+		for i := 0; i+epollEventSize <= len(b); i += epollEventSize {
+			events, data := binary.LittleEndian.Uint32(b[i:]), binary.LittleEndian.Uint64(b[i+4:])
+			if fd, ok := r.epoll[epollKey{tgid, epfd, data}]; ok {
+				fired = append(fired, fmt.Sprintf("fd %d %s", fd, describeFlags(pollEvents, events)))
+			} else {
+				fired = append(fired, fmt.Sprintf("data=%#x %s", data, describeFlags(pollEvents, events)))
+			}
+		}
+		return fmt.Sprintf("%s(%d) = %d [%s]", name, epfd, ret, strings.Join(fired, ", ")), true
+
+	case "poll", "ppoll":
+		n := int(min64(args[1], readinessMaxFds))
+		b, err := strace.PeekData(pid, uintptr(args[0]), n*pollFdSize)
+		if err != nil {
+			return fmt.Sprintf("%s(%d fds) = %d", name, args[1], ret), true
+		}
+		var watched, fired []string
+		for i := 0; i+pollFdSize <= len(b); i += pollFdSize {
+			fd := int32(binary.LittleEndian.Uint32(b[i:]))
+			events, revents := binary.LittleEndian.Uint16(b[i+4:]), binary.LittleEndian.Uint16(b[i+6:])
+			watched = append(watched, fmt.Sprintf("fd %d %s", fd, describeFlags(pollEvents, uint32(events))))
+			if !failed && revents != 0 {
+				fired = append(fired, fmt.Sprintf("fd %d %s", fd, describeFlags(pollEvents, uint32(revents))))
+			}
+		}
+		return fmt.Sprintf("%s([%s]) = %d [%s]", name, strings.Join(watched, ", "), ret, strings.Join(fired, ", ")), true
+
+	case "inotify_init", "inotify_init1":
+		if !failed {
+			r.inotify[fdKey{tgid, int(ret)}] = true
+		}
+	case "inotify_add_watch":
+		fd := int(int32(args[0]))
+		path, _ := strace.PeekString(pid, uintptr(args[1]), 4096)
+		if !failed {
+			r.watches[inotifyKey{tgid, fd, int(ret)}] = path
+		}
+		return fmt.Sprintf("inotify_add_watch(%d, %q, %s) = %d", fd, path, describeFlags(inotifyEvents, uint32(args[2])), ret), true
+	case "read":
+		fd := int(int32(args[0]))
+		if failed || !r.inotify[fdKey{tgid, fd}] {
+			return "", false
+		}
+		b, err := strace.PeekData(pid, uintptr(args[1]), int(ret))
+		if err != nil {
+			return "", false
+		}
+		var events []string
+		for i := 0; i+inotifyEventSize <= len(b); {
+			wd := int(int32(binary.LittleEndian.Uint32(b[i:])))
+			mask := binary.LittleEndian.Uint32(b[i+4:])
+			size := int(binary.LittleEndian.Uint32(b[i+12:]))
+			path := r.watches[inotifyKey{tgid, fd, wd}]
+			if end := i + inotifyEventSize + size; size > 0 && end <= len(b) {
+				path += "/" + strings.TrimRight(string(b[i+inotifyEventSize:end]), "\x00")
+			}
+			events = append(events, fmt.Sprintf("%s %s", path, describeFlags(inotifyEvents, mask)))
+			i += inotifyEventSize + size
+		}
+		return fmt.Sprintf("inotify read(%d) = %d [%s]", fd, ret, strings.Join(events, ", ")), true
+	case "close":
+		fd := int(int32(args[0]))
+		delete(r.inotify, fdKey{tgid, fd})
+		for k := range r.watches {
+			if k.tgid == tgid && k.fd == fd {
+				delete(r.watches, k)
+			}
+		}
+		for k := range r.epoll {
+			if k.tgid == tgid && k.epfd == fd {
+				delete(r.epoll, k)
+			}
+		}
+	}
+	return "", false
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
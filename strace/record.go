@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// trace files (-record) store every syscall event of a trace so it can be replayed later with other
+// filters and outputs. everything is little endian:
+//
+//	header:  "STRACE" version:u8 command:strings
+//	records: kind:u8 followed by
+//	  event:   pid:i32 stage:u8 nr:u64 name:string time:i64(unix ns)
+//	           enter: args:6*u64 paths:strings (what -path matches on)
+//	           exit:  ret:i64 duration:i64(ns)
+//	  process: pid:i32 name:string
+//	  end:     pid:i32 detached:u8 status:u32 rusage:struct rusage
+//
+// where a string is len:u16 bytes and strings is count:u16 string...
+const (
+	traceMagic   = "STRACE"
+	traceVersion = 1
+
+	recordEvent   = 1
+	recordProcess = 2
+	recordEnd     = 3
+)
+
+type recorder struct {
+	f     *os.File
+	w     *bufio.Writer
+	named map[int]bool // pids whose process name has been recorded
+}
+
+func newRecorder(path string, command []string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{f: f, w: bufio.NewWriter(f), named: map[int]bool{}}
+	r.w.WriteString(traceMagic)
+	r.w.WriteByte(traceVersion)
+	r.strings(command)
+	return r, nil
+}
+
+func (r *recorder) put(v interface{}) {
+	binary.Write(r.w, binary.LittleEndian, v)
+}
+
+func (r *recorder) string(s string) {
+	if len(s) > 0xffff {
+		s = s[:0xffff]
+	}
+	r.put(uint16(len(s)))
+	r.w.WriteString(s)
+}
+
+func (r *recorder) strings(ss []string) {
+	r.put(uint16(len(ss)))
+	for _, s := range ss {
+		r.string(s)
+	}
+}
+
+// event records e, paths are the ones it touches on entry
+func (r *recorder) event(e strace.SyscallEvent, paths []string) {
+	if !r.named[e.PID] {
+		r.named[e.PID] = true
+		r.w.WriteByte(recordProcess)
+		r.put(int32(e.PID))
+		r.string(procName(e.PID))
+	}
+
+	r.w.WriteByte(recordEvent)
+	r.put(int32(e.PID))
+	r.put(uint8(e.Stage))
+	r.put(e.Nr)
+	r.string(e.Name)
+	r.put(e.Time.UnixNano())
+	if e.Stage == strace.Enter {
+		r.put(e.Args)
+		r.strings(paths)
+	} else {
+		r.put(e.RetVal)
+		r.put(int64(e.Duration))
+	}
+}
+
+// close records how the trace ended
+func (r *recorder) close(res *strace.Result) error {
+	r.w.WriteByte(recordEnd)
+	r.put(int32(res.Pid))
+	detached := uint8(0)
+	if res.Detached {
+		detached = 1
+	}
+	r.put(detached)
+	r.put(uint32(res.Status))
+	r.put(res.Rusage)
+
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// traceReader reads back a trace file
+type traceReader struct {
+	r       *bufio.Reader
+	command []string
+}
+
+func openTrace(path string) (*traceReader, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &traceReader{r: bufio.NewReader(f)}
+
+	magic := make([]byte, len(traceMagic)+1)
+	if _, err := io.ReadFull(t.r, magic); err != nil || string(magic[:len(traceMagic)]) != traceMagic {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is not a trace file", path)
+	}
+	if magic[len(traceMagic)] != traceVersion {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is a version %d trace file, only %d is supported", path, magic[len(traceMagic)], traceVersion)
+	}
+	if t.command, err = t.strings(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return t, f, nil
+}
+
+func (t *traceReader) get(v interface{}) error {
+	return binary.Read(t.r, binary.LittleEndian, v)
+}
+
+func (t *traceReader) string() (string, error) {
+	var n uint16
+	if err := t.get(&n); err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(t.r, b)
+	return string(b), err
+}
+
+func (t *traceReader) strings() ([]string, error) {
+	var n uint16
+	if err := t.get(&n); err != nil {
+		return nil, err
+	}
+	var ss []string
+	for i := 0; i < int(n); i++ {
+		s, err := t.string()
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// replay calls onProcess and onSyscall for every record, in the order they were traced, until the end
+// of the trace or until stop returns true. a trace that was cut short (strace got killed) replays up to
+// where it ends, with a result that says it was detached
+func (t *traceReader) replay(onProcess func(pid int, name string), onSyscall func(e strace.SyscallEvent, paths []string), stop func() bool) (*strace.Result, error) {
+	res := &strace.Result{Detached: true}
+	for !stop() {
+		kind, err := t.r.ReadByte()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case recordProcess:
+			var pid int32
+			if err := t.get(&pid); err != nil {
+				return truncated(res, err)
+			}
+			name, err := t.string()
+			if err != nil {
+				return truncated(res, err)
+			}
+			res.Pid = int(pid)
+			onProcess(int(pid), name)
+
+		case recordEvent:
+			e, paths, err := t.event()
+			if err != nil {
+				return truncated(res, err)
+			}
+			onSyscall(e, paths)
+
+		case recordEnd:
+			var end struct {
+				Pid      int32
+				Detached uint8
+				Status   uint32
+				Rusage   syscall.Rusage
+			}
+			if err := t.get(&end); err != nil {
+				return truncated(res, err)
+			}
+			return &strace.Result{
+				Pid:      int(end.Pid),
+				Detached: end.Detached != 0,
+				Status:   syscall.WaitStatus(end.Status),
+				Rusage:   end.Rusage,
+			}, nil
+
+		default:
+			return nil, fmt.Errorf("bad record kind %d in trace file", kind)
+		}
+	}
+	return res, nil
+}
+
+func (t *traceReader) event() (strace.SyscallEvent, []string, error) {
+	var head struct {
+		Pid   int32
+		Stage uint8
+		Nr    uint64
+	}
+	if err := t.get(&head); err != nil {
+		return strace.SyscallEvent{}, nil, err
+	}
+	name, err := t.string()
+	if err != nil {
+		return strace.SyscallEvent{}, nil, err
+	}
+	var ts int64
+	if err := t.get(&ts); err != nil {
+		return strace.SyscallEvent{}, nil, err
+	}
+	e := strace.SyscallEvent{
+		PID:   int(head.Pid),
+		Stage: strace.Stage(head.Stage),
+		Nr:    head.Nr,
+		Name:  name,
+		Time:  time.Unix(0, ts),
+	}
+
+	var paths []string
+	if e.Stage == strace.Enter {
+		if err := t.get(&e.Args); err != nil {
+			return e, nil, err
+		}
+		paths, err = t.strings()
+	} else {
+		var exit struct{ Ret, Duration int64 }
+		err = t.get(&exit)
+		e.RetVal, e.Duration = exit.Ret, time.Duration(exit.Duration)
+	}
+	return e, paths, err
+}
+
+// truncated ends the replay of a trace file that stops in the middle of a record
+func truncated(res *strace.Result, err error) (*strace.Result, error) {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return res, nil
+	}
+	return nil, err
+}
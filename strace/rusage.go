@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+func printRusage(w io.Writer, ru *syscall.Rusage) {
+	fmt.Fprintf(w, "user time    %v\n", time.Duration(ru.Utime.Nano()))
+	fmt.Fprintf(w, "system time  %v\n", time.Duration(ru.Stime.Nano()))
+	fmt.Fprintf(w, "max rss      %d KiB\n", ru.Maxrss)
+	fmt.Fprintf(w, "voluntary context switches   %d\n", ru.Nvcsw)
+	fmt.Fprintf(w, "involuntary context switches %d\n", ru.Nivcsw)
+}
+
+// exitCode maps the tracee's final wait status to the code we exit with,
+// a killed tracee exits 128+signal the same way shells report it
+func exitCode(ws syscall.WaitStatus) int {
+	switch {
+	case ws.Exited():
+		return ws.ExitStatus()
+	case ws.Signaled():
+		return 128 + int(ws.Signal())
+	}
+	return 0
+}
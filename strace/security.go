@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// -security decodes the calls sandboxing code is made of, prctl, seccomp, capset, the rlimits and the set*id
+// family, and points out the ones that change what the process is allowed to do, like dropping privileges
+// or installing a seccomp filter, when they succeed
+
+var prctlOptions = map[uint64]string{
+	1: "PR_SET_PDEATHSIG", 2: "PR_GET_PDEATHSIG", 3: "PR_GET_DUMPABLE", 4: "PR_SET_DUMPABLE",
+	7: "PR_GET_KEEPCAPS", 8: "PR_SET_KEEPCAPS", 15: "PR_SET_NAME", 16: "PR_GET_NAME",
+	21: "PR_GET_SECCOMP", 22: "PR_SET_SECCOMP", 23: "PR_CAPBSET_READ", 24: "PR_CAPBSET_DROP",
+	27: "PR_GET_SECUREBITS", 28: "PR_SET_SECUREBITS", 35: "PR_SET_MM", 36: "PR_SET_CHILD_SUBREAPER",
+	38: "PR_SET_NO_NEW_PRIVS", 39: "PR_GET_NO_NEW_PRIVS", 47: "PR_CAP_AMBIENT", 0x59616d61: "PR_SET_PTRACER",
+}
+
+var seccompOps = map[uint64]string{
+	0: "SECCOMP_SET_MODE_STRICT", 1: "SECCOMP_SET_MODE_FILTER", 2: "SECCOMP_GET_ACTION_AVAIL", 3: "SECCOMP_GET_NOTIF_SIZES",
+}
+
+var seccompFlags = []flagName{
+	{0x1, "SECCOMP_FILTER_FLAG_TSYNC"}, {0x2, "SECCOMP_FILTER_FLAG_LOG"}, {0x4, "SECCOMP_FILTER_FLAG_SPEC_ALLOW"},
+	{0x8, "SECCOMP_FILTER_FLAG_NEW_LISTENER"}, {0x10, "SECCOMP_FILTER_FLAG_TSYNC_ESRCH"},
+}
+
+var capAmbientOps = map[uint64]string{1: "PR_CAP_AMBIENT_IS_SET", 2: "PR_CAP_AMBIENT_RAISE", 3: "PR_CAP_AMBIENT_LOWER", 4: "PR_CAP_AMBIENT_CLEAR_ALL"}
+
+var capNames = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID",
+	"CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST", "CAP_NET_ADMIN",
+	"CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER", "CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE", "CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM", "CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+var rlimitNames = []string{
+	"RLIMIT_CPU", "RLIMIT_FSIZE", "RLIMIT_DATA", "RLIMIT_STACK", "RLIMIT_CORE", "RLIMIT_RSS", "RLIMIT_NPROC",
+	"RLIMIT_NOFILE", "RLIMIT_MEMLOCK", "RLIMIT_AS", "RLIMIT_LOCKS", "RLIMIT_SIGPENDING", "RLIMIT_MSGQUEUE",
+	"RLIMIT_NICE", "RLIMIT_RTPRIO", "RLIMIT_RTTIME",
+}
+
+const (
+	capUserHeaderSize = 8  // version, pid
+	capUserDataSize   = 12 // effective, permitted, inheritable
+	capVersion1       = 0x19980330
+	rlimitSize        = 16
+	sockFprogSize     = 16 // len, padding, filter pointer
+)
+
+// describeSecurity decodes a syscall that just returned, given its entry args. reason says what changed,
+// and is empty unless the call dropped privileges or restricted the process. ok is false for other syscalls
+func describeSecurity(pid int, name string, args [6]uint64, ret int64) (line, reason string, ok bool) {
+	failed := ret < 0 && ret > -4096
+	result := fmt.Sprint(ret)
+	if failed {
+		result = fmt.Sprintf("%d (%s)", ret, errnoName(syscall.Errno(-ret)))
+	}
+
+	var call string
+	switch name {
+	case "prctl":
+		call, reason = describePrctl(pid, args)
+	case "seccomp":
+		op := lookupName(seccompOps, args[0])
+		call = fmt.Sprintf("seccomp(%s, %s)", op, describeFlags(seccompFlags, uint32(args[1])))
+		switch args[0] {
+		case 0:
+			reason = "only read, write and exit from now on"
+		case 1:
+			n := filterLength(pid, args[2])
+			call = fmt.Sprintf("seccomp(%s, %s, %s)", op, describeFlags(seccompFlags, uint32(args[1])), n)
+			reason = "installs a seccomp filter of " + n
+		}
+	case "capset":
+		call = describeCapset(pid, args)
+		reason = "sets capabilities"
+	case "setrlimit", "getrlimit":
+		call = fmt.Sprintf("%s(%s, %s)", name, lookupIndex(rlimitNames, args[0]), readRlimit(pid, args[1]))
+		if name == "setrlimit" {
+			reason = rlimitReason(args[0])
+		}
+	case "prlimit64":
+		resource := lookupIndex(rlimitNames, args[1])
+		switch {
+		case args[2] != 0:
+			call = fmt.Sprintf("prlimit64(%d, %s, %s)", int32(args[0]), resource, readRlimit(pid, args[2]))
+			reason = rlimitReason(args[1])
+		case args[3] != 0 && !failed:
+			call = fmt.Sprintf("prlimit64(%d, %s, NULL) old %s", int32(args[0]), resource, readRlimit(pid, args[3]))
+		default:
+			call = fmt.Sprintf("prlimit64(%d, %s, NULL)", int32(args[0]), resource)
+		}
+	case "setuid", "setgid", "setfsuid", "setfsgid":
+		call = fmt.Sprintf("%s(%d)", name, int32(args[0]))
+		reason = "changes identity"
+	case "setreuid", "setregid":
+		call = fmt.Sprintf("%s(%d, %d)", name, int32(args[0]), int32(args[1]))
+		reason = "changes identity"
+	case "setresuid", "setresgid":
+		call = fmt.Sprintf("%s(%d, %d, %d)", name, int32(args[0]), int32(args[1]), int32(args[2]))
+		reason = "changes identity"
+	case "setgroups":
+		call = fmt.Sprintf("setgroups(%d)", args[0])
+		if args[0] == 0 {
+			reason = "drops the supplementary groups"
+		} else {
+			reason = "sets the supplementary groups"
+		}
+	default:
+		return "", "", false
+	}
+	if failed {
+		reason = ""
+	}
+	return fmt.Sprintf("%s = %s", call, result), reason, true
+}
+
+func describePrctl(pid int, args [6]uint64) (call, reason string) {
+	option := lookupName(prctlOptions, args[0])
+	call = fmt.Sprintf("prctl(%s, %#x)", option, args[1])
+	switch args[0] {
+	case 4: // PR_SET_DUMPABLE
+		call = fmt.Sprintf("prctl(%s, %d)", option, args[1])
+		if args[1] == 0 {
+			reason = "can't be ptraced or dump core"
+		}
+	case 8: // PR_SET_KEEPCAPS
+		call = fmt.Sprintf("prctl(%s, %d)", option, args[1])
+		reason = "keeps capabilities across a setuid"
+	case 15: // PR_SET_NAME
+		name, _ := strace.PeekString(pid, uintptr(args[1]), 16)
+		call = fmt.Sprintf("prctl(%s, %q)", option, name)
+	case 22: // PR_SET_SECCOMP
+		switch args[1] {
+		case 1:
+			call = fmt.Sprintf("prctl(%s, SECCOMP_MODE_STRICT)", option)
+			reason = "only read, write and exit from now on"
+		case 2:
+			n := filterLength(pid, args[2])
+			call = fmt.Sprintf("prctl(%s, SECCOMP_MODE_FILTER, %s)", option, n)
+			reason = "installs a seccomp filter of " + n
+		}
+	case 23, 24: // PR_CAPBSET_READ, PR_CAPBSET_DROP
+		call = fmt.Sprintf("prctl(%s, %s)", option, lookupIndex(capNames, args[1]))
+		if args[0] == 24 {
+			reason = "drops a capability from the bounding set"
+		}
+	case 28: // PR_SET_SECUREBITS
+		reason = "changes the securebits"
+	case 38: // PR_SET_NO_NEW_PRIVS
+		call = fmt.Sprintf("prctl(%s, %d)", option, args[1])
+		if args[1] == 1 {
+			reason = "no new privileges, exec can't gain any from setuid bits or file caps"
+		}
+	case 47: // PR_CAP_AMBIENT
+		call = fmt.Sprintf("prctl(%s, %s, %s)", option, lookupName(capAmbientOps, args[1]), lookupIndex(capNames, args[2]))
+		switch args[1] {
+		case 2:
+			reason = "raises an ambient capability"
+		case 3, 4:
+			reason = "drops ambient capabilities"
+		}
+	case 0x59616d61: // PR_SET_PTRACER
+		call = fmt.Sprintf("prctl(%s, %d)", option, int32(args[1]))
+		reason = "lets another process ptrace it"
+	}
+	return call, reason
+}
+
+// describeCapset reads the capability sets being set, version 1 headers have a single 32 bit set,
+// the later ones two, for capabilities 0-31 and 32-63
+func describeCapset(pid int, args [6]uint64) string {
+	hdr, err := strace.PeekData(pid, uintptr(args[0]), capUserHeaderSize)
+	if err != nil || len(hdr) < capUserHeaderSize {
+		return fmt.Sprintf("capset(%#x, %#x)", args[0], args[1])
+	}
+	version, target := binary.LittleEndian.Uint32(hdr), int32(binary.LittleEndian.Uint32(hdr[4:]))
+	sets := 2
+	if version == capVersion1 {
+		sets = 1
+	}
+	data, err := strace.PeekData(pid, uintptr(args[1]), sets*capUserDataSize)
+	if err != nil || len(data) < sets*capUserDataSize {
+		return fmt.Sprintf("capset(pid %d, %#x)", target, args[1])
+	}
+	var effective, permitted, inheritable uint64
+	for i := 0; i < sets; i++ {
+		b := data[i*capUserDataSize:]
+		effective |= uint64(binary.LittleEndian.Uint32(b)) << (32 * i)
+		permitted |= uint64(binary.LittleEndian.Uint32(b[4:])) << (32 * i)
+		inheritable |= uint64(binary.LittleEndian.Uint32(b[8:])) << (32 * i)
+	}
+	return fmt.Sprintf("capset(pid %d, effective=%s, permitted=%s, inheritable=%s)",
+		target, describeCaps(effective), describeCaps(permitted), describeCaps(inheritable))
+}
+
+func describeCaps(set uint64) string {
+	if all := uint64(1)<<len(capNames) - 1; set&all == all {
+		return "all"
+	}
+	var s []string
+	for i, name := range capNames {
+		if set&(1<<i) != 0 {
+			s = append(s, name)
+		}
+	}
+	if len(s) == 0 {
+		return "0"
+	}
+	return strings.Join(s, "|")
+}
+
+// filterLength reads how many instructions the struct sock_fprog of a seccomp filter has
+func filterLength(pid int, addr uint64) string {
+	b, err := strace.PeekData(pid, uintptr(addr), sockFprogSize)
+	if err != nil || len(b) < sockFprogSize {
+		return "? instructions"
+	}
+	return fmt.Sprintf("%d instructions", binary.LittleEndian.Uint16(b))
+}
+
+func readRlimit(pid int, addr uint64) string {
+	b, err := strace.PeekData(pid, uintptr(addr), rlimitSize)
+	if err != nil || len(b) < rlimitSize {
+		return fmt.Sprintf("%#x", addr)
+	}
+	limit := func(v uint64) string {
+		if v == ^uint64(0) {
+			return "RLIM_INFINITY"
+		}
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("{cur=%s, max=%s}", limit(binary.LittleEndian.Uint64(b)), limit(binary.LittleEndian.Uint64(b[8:])))
+}
+
+// rlimitReason points out the limits sandboxes set, no core dumps, no forking, few fds
+func rlimitReason(resource uint64) string {
+	switch resource {
+	case 4, 6, 7: // RLIMIT_CORE, RLIMIT_NPROC, RLIMIT_NOFILE
+		return "restricts " + rlimitNames[resource]
+	}
+	return ""
+}
+
+func lookupName(names map[uint64]string, v uint64) string {
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return fmt.Sprint(v)
+}
+
+func lookupIndex(names []string, v uint64) string {
+	if v < uint64(len(names)) {
+		return names[v]
+	}
+	return fmt.Sprint(v)
+}
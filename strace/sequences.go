@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sequenceTracker slides a window of n syscalls over every thread's traced syscalls. -learn collects the
+// n-grams of a baseline run, or of several, the file grows with every run, and -baseline points out the ones
+// a later run makes that the baseline never did: a new code path, a config change, or something injected
+type sequenceTracker struct {
+	n        int
+	windows  map[int][]string // the last n-1 syscalls of every thread
+	seen     map[string]int
+	baseline map[string]int // nil without -baseline
+	unseen   map[string]int
+	learned  *sequenceFile // what's in the -learn file already
+}
+
+// sequenceFile is what -learn writes and -baseline reads, every sequence is its syscalls joined by spaces
+type sequenceFile struct {
+	N         int            `json:"n"`
+	Sequences map[string]int `json:"sequences"`
+}
+
+func newSequenceTracker(n int) *sequenceTracker {
+	return &sequenceTracker{n: n, windows: map[int][]string{}, seen: map[string]int{}, unseen: map[string]int{}}
+}
+
+func loadSequences(path string) (*sequenceFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f sequenceFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if f.N < 1 || f.Sequences == nil {
+		return nil, fmt.Errorf("%s is not a -learn file", path)
+	}
+	return &f, nil
+}
+
+// compareTo sets the baseline, its n wins over -ngram
+func (s *sequenceTracker) compareTo(path string) error {
+	f, err := loadSequences(path)
+	if err != nil {
+		return err
+	}
+	s.n = f.N
+	s.baseline = f.Sequences
+	return nil
+}
+
+// enter adds a syscall to the thread's window, the sequence it completes is returned when the baseline
+// doesn't have it and it's the first time this run made it
+func (s *sequenceTracker) enter(pid int, name string) (string, bool) {
+	window := append(s.windows[pid], name)
+	if len(window) < s.n {
+		s.windows[pid] = window
+		return "", false
+	}
+	seq := strings.Join(window, " ")
+	s.windows[pid] = append(window[:0:0], window[1:]...)
+	s.seen[seq]++
+	if s.baseline == nil || s.baseline[seq] > 0 {
+		return "", false
+	}
+	s.unseen[seq]++
+	return seq, s.unseen[seq] == 1
+}
+
+// learnInto reads the -learn file before the trace, so a mismatching one fails before the run and not after
+func (s *sequenceTracker) learnInto(path string) error {
+	f, err := loadSequences(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		f = &sequenceFile{N: s.n, Sequences: map[string]int{}}
+	case err != nil:
+		return err
+	case f.N != s.n:
+		return fmt.Errorf("%s has sequences of %d syscalls, not %d", path, f.N, s.n)
+	}
+	s.learned = f
+	return nil
+}
+
+// learn adds the sequences of this run to the -learn file at path
+func (s *sequenceTracker) learn(path string) error {
+	f := s.learned
+	for seq, n := range s.seen {
+		f.Sequences[seq] += n
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+func (s *sequenceTracker) print(w io.Writer, baseline string) {
+	total, unseen := 0, 0
+	for _, n := range s.seen {
+		total += n
+	}
+	seqs := make([]string, 0, len(s.unseen))
+	for seq, n := range s.unseen {
+		seqs = append(seqs, seq)
+		unseen += n
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		if s.unseen[seqs[i]] != s.unseen[seqs[j]] {
+			return s.unseen[seqs[i]] > s.unseen[seqs[j]]
+		}
+		return seqs[i] < seqs[j]
+	})
+	fmt.Fprintf(w, ">>>sequences not in %s: %d of %d, %d different\n", baseline, unseen, total, len(seqs))
+	for _, seq := range seqs {
+		fmt.Fprintf(w, "%s -> %d\n", seq, s.unseen[seq])
+	}
+}
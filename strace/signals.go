@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// handleInterrupt detaches t on SIGINT/SIGTERM, so the trace ends with the summary so far
+// and the tracee keeps running instead of going down with us
+func handleInterrupt(t *strace.Tracer) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		t.Detach()
+	}()
+}
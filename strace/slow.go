@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// callLine is a syscall that just returned, for the calls -slower-than, -failed-only and -grep print
+type callLine struct {
+	name, args string
+	ret        int64
+	d          time.Duration
+}
+
+// bufferArgs are the data arguments printed as strings, up to -s bytes, with the argument of their length.
+// written data is there on entry, read data only once the call returned how much it read, -1 for len
+var bufferArgs = map[string]struct{ buf, len int }{
+	"write": {1, 2}, "pwrite64": {1, 2}, "send": {1, 2}, "sendto": {1, 2},
+	"read": {1, -1}, "pread64": {1, -1}, "recv": {1, -1}, "recvfrom": {1, -1},
+}
+
+// describeCall renders a syscall given its entry args
+func describeCall(pid int, name string, args [6]uint64, ret int64, d time.Duration) callLine {
+	if s, ok := pluginArgs(pid, name, args); ok {
+		return callLine{name, s, ret, d}
+	}
+	s := argStrings(pid, name, args)
+	if *stringLimit == 0 {
+		return callLine{name, strings.Join(s, ", "), ret, d}
+	}
+	if b, ok := bufferArgs[name]; ok && ret >= 0 {
+		n := ret
+		if b.len >= 0 {
+			n = int64(args[b.len])
+		}
+		s[b.buf] = describeBuffer(pid, args[b.buf], n)
+	}
+	if st, ok := statArgs[name]; ok && ret == 0 {
+		if v, ok := st.describe(pid, args[st.arg]); ok {
+			s[st.arg] = v
+		}
+	}
+	return callLine{name, strings.Join(s, ", "), ret, d}
+}
+
+func (c callLine) result() string {
+	if c.ret < 0 && c.ret > -4096 {
+		return fmt.Sprintf("%d (%s)", c.ret, syscall.Errno(-c.ret))
+	}
+	return fmt.Sprint(c.ret)
+}
+
+// String is the plain line, the one -grep matches against
+func (c callLine) String() string {
+	return fmt.Sprintf("%s(%s) = %s <%v>", c.name, c.args, c.result(), c.d)
+}
+
+// render is the line for the terminal, aligned and colored
+func (c callLine) render() string {
+	pad := resultColumn - len(c.name) - len(c.args) - 2
+	if pad < 1 {
+		pad = 1
+	}
+	result := c.result()
+	if c.ret < 0 && c.ret > -4096 {
+		result = paint(colorError, result)
+	}
+	return fmt.Sprintf("%s(%s)%s= %s %s", paint(colorName, c.name), c.args, strings.Repeat(" ", pad), result, paint(colorDim, fmt.Sprintf("<%v>", c.d)))
+}
+
+// formatArgs prints path arguments as strings, flags by name and everything else in hex, we don't know
+// how many arguments a syscall takes so all six are shown
+func formatArgs(pid int, name string, args [6]uint64) string {
+	if s, ok := pluginArgs(pid, name, args); ok {
+		return s
+	}
+	return strings.Join(argStrings(pid, name, args), ", ")
+}
+
+// describeBuffer quotes the first -s bytes of the n at addr, ... marks the ones left out
+func describeBuffer(pid int, addr uint64, n int64) string {
+	more := ""
+	if n > int64(*stringLimit) {
+		n, more = int64(*stringLimit), "..."
+	}
+	b, err := strace.PeekData(pid, uintptr(addr), int(n))
+	if err != nil {
+		if !peekFault(err) {
+			return fmt.Sprintf("%#x", addr)
+		}
+		return unreadable(string(b), addr)
+	}
+	return fmt.Sprintf("%q%s", b, more)
+}
+
+// peekFaults counts the strings and buffers of printed calls that were cut short, or not there at all,
+// because the tracee passed a pointer to memory that isn't mapped
+var peekFaults int
+
+// peekFault reports whether a read from the tracee failed on unmapped memory, and counts it. anything else,
+// like a tracee that's gone or a replay, just means there's nothing to read
+func peekFault(err error) bool {
+	if err == syscall.EIO || err == syscall.EFAULT {
+		peekFaults++
+		return true
+	}
+	return false
+}
+
+// unreadable is a string that couldn't be read to its end, what there was of it and a marker
+func unreadable(prefix string, addr uint64) string {
+	if prefix == "" {
+		return fmt.Sprintf("%#x <unreadable>", addr)
+	}
+	return fmt.Sprintf("%q...<unreadable>", prefix)
+}
+
+func argStrings(pid int, name string, args [6]uint64) []string {
+	s := make([]string, len(args))
+	for i, a := range args {
+		s[i] = fmt.Sprintf("%#x", a)
+	}
+	if name == "ioctl" {
+		s[1] = describeIoctl(args[1])
+	}
+	for i, describe := range flagArgs[name] {
+		s[i] = describe(args[i])
+	}
+	for _, a := range pathArgs[name] {
+		if a.dirfd >= 0 && int32(args[a.dirfd]) == atFdcwd {
+			s[a.dirfd] = "AT_FDCWD"
+		}
+		if *stringLimit == 0 {
+			continue
+		}
+		path, err := strace.PeekString(pid, uintptr(args[a.path]), 4096)
+		if err != nil && peekFault(err) {
+			s[a.path] = unreadable(path, args[a.path])
+		}
+		if err == nil {
+			s[a.path] = fmt.Sprintf("%q", path)
+			if root := traceeRoot(pid); *hostPaths && root != "/" {
+				if host := hostView(pid, root, path, a.dirfd, args); host != "" {
+					s[a.path] += fmt.Sprintf(" (host %q)", host)
+				}
+			}
+		}
+	}
+	return s
+}
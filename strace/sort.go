@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryOrders are what -sort orders the summary by, the biggest first
+var summaryOrders = map[string]func(calls int, c *summaryCount) float64{
+	"count":  func(calls int, _ *summaryCount) float64 { return float64(calls) },
+	"time":   func(_ int, c *summaryCount) float64 { return float64(c.Time) },
+	"avg":    func(_ int, c *summaryCount) float64 { return float64(c.average()) },
+	"errors": func(_ int, c *summaryCount) float64 { return float64(c.Errors) },
+}
+
+func checkSummaryOrder(by string) error {
+	if _, ok := summaryOrders[by]; by != "" && !ok {
+		orders := make([]string, 0, len(summaryOrders))
+		for order := range summaryOrders {
+			orders = append(orders, order)
+		}
+		sort.Strings(orders)
+		return fmt.Errorf("-sort %q isn't one of %s", by, strings.Join(orders, ", "))
+	}
+	return nil
+}
+
+func (c *summaryCount) average() time.Duration {
+	if c.Calls == 0 {
+		return 0
+	}
+	return c.Time / time.Duration(c.Calls)
+}
+
+// printSorted prints the counts of the summary ordered by -sort, with their time, average and errors, at most
+// limit of them if it's more than 0. counts are of the calls entered, the rest of the ones that returned
+func printSorted(w io.Writer, counts map[string]int, stats *summary, by string, limit int) {
+	order := summaryOrders[by]
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	stat := func(name string) *summaryCount {
+		if c, ok := stats.Syscalls[name]; ok {
+			return c
+		}
+		return &summaryCount{} // it never returned, like exit_group
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := order(counts[names[i]], stat(names[i])), order(counts[names[j]], stat(names[j]))
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	for _, name := range names {
+		c := stat(name)
+		fmt.Fprintf(w, "%s -> %v (%v, avg %v, %d errors)\n", name, counts[name], c.Time, c.average(), c.Errors)
+	}
+}
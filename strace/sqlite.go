@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteExport writes every syscall as a row of a syscalls table, for ad-hoc sql over big traces, eg
+//
+//	select name, count(*), sum(duration) / 1e6 as ms from syscalls group by name order by ms desc
+type sqliteExport struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	insert *sql.Stmt
+	rows   int
+	err    error // first insert error, reported by close
+}
+
+const sqliteSchema = `
+create table if not exists syscalls (
+	pid      integer not null,
+	ts       integer not null, -- entry, unix nanoseconds
+	name     text    not null,
+	args     text    not null, -- as -slower-than prints them, paths as strings
+	ret      integer not null,
+	duration integer not null  -- nanoseconds
+);
+create index if not exists syscalls_name on syscalls (name);
+`
+
+// rows go in transactions of this many, one transaction per row is very slow
+const sqliteBatch = 10000
+
+func newSQLiteExport(path string) (*sqliteExport, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	e := &sqliteExport{db: db}
+	if err := e.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *sqliteExport) begin() error {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare("insert into syscalls (pid, ts, name, args, ret, duration) values (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	e.tx, e.insert = tx, insert
+	return nil
+}
+
+func (e *sqliteExport) commit() error {
+	e.insert.Close()
+	return e.tx.Commit()
+}
+
+func (e *sqliteExport) add(pid int, name, args string, enter time.Time, ret int64, d time.Duration) {
+	if e.err != nil {
+		return
+	}
+	if _, e.err = e.insert.Exec(pid, enter.UnixNano(), name, args, ret, int64(d)); e.err != nil {
+		return
+	}
+	if e.rows++; e.rows%sqliteBatch == 0 {
+		if e.err = e.commit(); e.err == nil {
+			e.err = e.begin()
+		}
+	}
+}
+
+func (e *sqliteExport) close() error {
+	if e.err == nil {
+		e.err = e.commit()
+	} else {
+		e.tx.Rollback()
+	}
+	if err := e.db.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
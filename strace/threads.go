@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// prctl option that names the calling thread
+const prSetName = 15
+
+// threadNameFilter keeps only the syscalls of threads whose name, /proc/<pid>/task/<tid>/comm, matches one of
+// its globs. names are read once per thread and again after it renames itself with prctl or execs, a name
+// another thread writes to its comm file is only seen after one of those
+type threadNameFilter struct {
+	patterns []string
+	names    map[int]string
+	tgids    threadGroups
+}
+
+func (f *threadNameFilter) String() string {
+	return strings.Join(f.patterns, ",")
+}
+
+func (f *threadNameFilter) Set(v string) error {
+	if _, err := path.Match(v, ""); err != nil {
+		return fmt.Errorf("bad thread name pattern %q: %w", v, err)
+	}
+	f.patterns = append(f.patterns, v)
+	return nil
+}
+
+// match reports whether the thread's name matches, everything matches without patterns
+func (f *threadNameFilter) match(tid int) bool {
+	if f.patterns == nil {
+		return true
+	}
+	name, ok := f.names[tid]
+	if !ok {
+		if f.names == nil {
+			f.names, f.tgids = map[int]string{}, threadGroups{}
+		}
+		name = threadName(f.tgids.of(tid), tid)
+		f.names[tid] = name
+	}
+	for _, pattern := range f.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exit forgets the name of a thread that just changed it
+func (f *threadNameFilter) exit(tid int, name string, args [6]uint64, ret int64) {
+	if f.names == nil || ret < 0 {
+		return
+	}
+	if (name == "prctl" && args[0] == prSetName) || name == "execve" || name == "execveat" {
+		delete(f.names, tid)
+	}
+}
+
+func threadName(tgid, tid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/task/%d/comm", tgid, tid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
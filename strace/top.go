@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// topTable is a live view of syscall activity, redrawn every interval by a separate goroutine
+// while the trace loop keeps feeding it. as a meter it's a single status line, rewritten in place
+type topTable struct {
+	mu      sync.Mutex
+	start   time.Time
+	rows    map[string]*topRow
+	meter   bool
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+type topRow struct {
+	name   string
+	calls  int
+	errors int
+	time   time.Duration
+
+	// totals at the previous redraw, used to compute per second rates
+	prevCalls  int
+	prevErrors int
+
+	callRate  float64
+	errorRate float64
+}
+
+// how many of the busiest syscalls the meter names
+const meterTopSyscalls = 3
+
+func newTopTable(meter bool) *topTable {
+	return &topTable{
+		start:   time.Now(),
+		rows:    map[string]*topRow{},
+		meter:   meter,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (t *topTable) record(name string, d time.Duration, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.rows[name]
+	if !ok {
+		r = &topRow{name: name}
+		t.rows[name] = r
+	}
+	r.calls++
+	r.time += d
+	if failed {
+		r.errors++
+	}
+}
+
+// run redraws the table to w every interval until stop is called
+func (t *topTable) run(w io.Writer, interval time.Duration) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-t.stopped:
+			if t.meter {
+				// leave the last line up, the summary starts below it
+				fmt.Fprintln(w)
+			}
+			return
+		case now := <-ticker.C:
+			t.draw(w, now.Sub(last))
+			last = now
+		}
+	}
+}
+
+func (t *topTable) stop() {
+	close(t.stopped)
+	<-t.done
+}
+
+func (t *topTable) draw(w io.Writer, elapsed time.Duration) {
+	t.mu.Lock()
+	rows := make([]*topRow, 0, len(t.rows))
+	for _, r := range t.rows {
+		r.callRate = float64(r.calls-r.prevCalls) / elapsed.Seconds()
+		r.errorRate = float64(r.errors-r.prevErrors) / elapsed.Seconds()
+		r.prevCalls, r.prevErrors = r.calls, r.errors
+		copied := *r
+		rows = append(rows, &copied)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].callRate != rows[j].callRate {
+			return rows[i].callRate > rows[j].callRate
+		}
+		return rows[i].time > rows[j].time
+	})
+
+	if t.meter {
+		var rate float64
+		for _, r := range rows {
+			rate += r.callRate
+		}
+		fmt.Fprintf(w, "\r\033[K%8.0f syscalls/s", rate)
+		for i, r := range rows {
+			if i == meterTopSyscalls || r.callRate == 0 {
+				break
+			}
+			fmt.Fprintf(w, "  %s %.0f", r.name, r.callRate)
+		}
+		return
+	}
+
+	// move the cursor home and clear the screen
+	fmt.Fprint(w, "\033[H\033[2J")
+	fmt.Fprintf(w, "tracing for %v\n\n", time.Since(t.start).Round(time.Second))
+	fmt.Fprintf(w, "%-20s %10s %10s %10s %10s %14s\n", "SYSCALL", "CALLS/S", "ERRORS/S", "CALLS", "ERRORS", "TIME")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%-20s %10.1f %10.1f %10d %10d %14v\n", r.name, r.callRate, r.errorRate, r.calls, r.errors, r.time)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// procTree is the hierarchy of processes and threads seen with -f, with the syscall totals of each
+type procTree struct {
+	start time.Time
+	procs map[int]*procNode
+	roots []int
+}
+
+type procNode struct {
+	pid, parent int
+	command     string
+	thread      bool
+	start, end  time.Time // end is zero while it runs
+	status      string    // how it ended
+	calls       int
+	time        time.Duration
+	children    []int
+}
+
+func newProcTree() *procTree {
+	return &procTree{start: time.Now(), procs: map[int]*procNode{}}
+}
+
+// node returns pid's node, adding it as a root if we've never seen it start (the main tracee)
+func (t *procTree) node(pid int, now time.Time) *procNode {
+	n, ok := t.procs[pid]
+	if !ok {
+		n = &procNode{pid: pid, command: procCommand(pid), start: now}
+		t.procs[pid] = n
+		t.roots = append(t.roots, pid)
+	}
+	return n
+}
+
+func (t *procTree) process(e strace.ProcessEvent) {
+	switch e.Kind {
+	case strace.Started:
+		parent := t.node(e.Parent, e.Time)
+		n, ok := t.procs[e.PID]
+		if !ok {
+			n = &procNode{pid: e.PID}
+			t.procs[e.PID] = n
+		}
+		// a child's first stop can beat its parent's fork event, so it may have been added as a root
+		for i, root := range t.roots {
+			if root == e.PID {
+				t.roots = append(t.roots[:i], t.roots[i+1:]...)
+				break
+			}
+		}
+		n.parent, n.start = e.Parent, e.Time
+		n.command, n.thread = parent.command, isThread(e.PID)
+		parent.children = append(parent.children, e.PID)
+	case strace.Exec:
+		t.node(e.PID, e.Time).command = procCommand(e.PID)
+	case strace.Exited:
+		n := t.node(e.PID, e.Time)
+		n.end = e.Time
+		if e.Status.Signaled() {
+			n.status = e.Status.Signal().String() // "killed", "segmentation fault", ...
+		} else {
+			n.status = fmt.Sprintf("exit %d", e.Status.ExitStatus())
+		}
+	}
+}
+
+// enter counts a syscall when it starts, like the summary does, and exit adds its time once it's done
+func (t *procTree) enter(pid int, now time.Time) {
+	t.node(pid, now).calls++
+}
+
+func (t *procTree) exit(pid int, d time.Duration, now time.Time) {
+	t.node(pid, now).time += d
+}
+
+// print draws the tree, with merge siblings running the same command are folded into one row
+func (t *procTree) print(w io.Writer, merge bool) {
+	t.printLevel(w, t.roots, "", true, merge)
+}
+
+func (t *procTree) printLevel(w io.Writer, pids []int, indent string, root, merge bool) {
+	groups := [][]*procNode{}
+	index := map[string]int{}
+	for _, pid := range pids {
+		n := t.procs[pid]
+		key := fmt.Sprint(pid)
+		if merge {
+			key = fmt.Sprint(n.thread, n.command)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], n)
+	}
+
+	for i, group := range groups {
+		branch, next := "├─ ", "│  "
+		if i == len(groups)-1 {
+			branch, next = "└─ ", "   "
+		}
+		if root {
+			branch, next = "", ""
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, branch, t.describe(group))
+
+		var children []int
+		for _, n := range group {
+			children = append(children, n.children...)
+		}
+		sort.Ints(children)
+		t.printLevel(w, children, indent+next, false, merge)
+	}
+}
+
+func (t *procTree) describe(group []*procNode) string {
+	n := group[0]
+	kind := ""
+	if n.thread {
+		kind = " (thread)"
+	}
+
+	if len(group) > 1 {
+		calls, total := 0, time.Duration(0)
+		for _, n := range group {
+			calls += n.calls
+			total += n.time
+		}
+		return fmt.Sprintf("%d× %s%s, %d syscalls %v", len(group), n.command, kind, calls, total)
+	}
+
+	end, status := "running", n.status
+	if !n.end.IsZero() {
+		end = fmt.Sprint(n.end.Sub(t.start).Round(time.Microsecond))
+	}
+	if status != "" {
+		status = ", " + status
+	}
+	return fmt.Sprintf("%d %s%s [%v - %s], %d syscalls %v%s",
+		n.pid, n.command, kind, n.start.Sub(t.start).Round(time.Microsecond), end, n.calls, n.time, status)
+}
+
+// procCommand is the command line of a running process, its name if that can't be read
+func procCommand(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(b) == 0 {
+		return procName(pid)
+	}
+	return strings.Join(strings.Split(string(bytes.TrimRight(b, "\x00")), "\x00"), " ")
+}
+
+// isThread reports whether tid is a thread of another process rather than a process of its own
+func isThread(tid int) bool {
+	return procTgid(tid) != tid
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// unixPeer is the other end of a unix socket, either side may be unknown
+type unixPeer struct {
+	path string // abstract names start with @
+	pid  int
+}
+
+func (p unixPeer) String() string {
+	s := fmt.Sprintf("%q", p.path)
+	if p.pid != 0 {
+		s += fmt.Sprintf(" peer pid %d (%s)", p.pid, procName(p.pid))
+	}
+	return s
+}
+
+// describeUnixPeer renders the unix socket peer of a connect/sendto/sendmsg that just returned,
+// ok is false for other syscalls and sockets that aren't unix
+func describeUnixPeer(pid int, name string, args [6]uint64, ret int64) (string, bool) {
+	fd := int(args[0])
+
+	var peer unixPeer
+	switch name {
+	case "connect":
+		path, ok := readSockaddrUnix(pid, uintptr(args[1]), int(args[2]))
+		if !ok {
+			return "", false
+		}
+		peer = unixPeer{path: path}
+		if ret == 0 {
+			if connected, ok := connectedPeer(pid, fd); ok {
+				peer.pid = connected.pid
+			}
+		}
+		if peer.pid == 0 {
+			peer.pid = listenerPid(path)
+		}
+	case "sendto":
+		if args[4] != 0 {
+			path, ok := readSockaddrUnix(pid, uintptr(args[4]), int(args[5]))
+			if !ok {
+				return "", false
+			}
+			peer = unixPeer{path: path, pid: listenerPid(path)}
+		} else {
+			var ok bool
+			if peer, ok = connectedPeer(pid, fd); !ok {
+				return "", false
+			}
+		}
+	case "sendmsg":
+		// struct msghdr starts with void *msg_name; socklen_t msg_namelen
+		hdr, err := strace.PeekData(pid, uintptr(args[1]), 12)
+		if err != nil || len(hdr) < 12 {
+			return "", false
+		}
+		if addr := binary.LittleEndian.Uint64(hdr); addr != 0 {
+			path, ok := readSockaddrUnix(pid, uintptr(addr), int(binary.LittleEndian.Uint32(hdr[8:])))
+			if !ok {
+				return "", false
+			}
+			peer = unixPeer{path: path, pid: listenerPid(path)}
+		} else {
+			var ok bool
+			if peer, ok = connectedPeer(pid, fd); !ok {
+				return "", false
+			}
+		}
+	default:
+		return "", false
+	}
+
+	return fmt.Sprintf("%s%s(%d, %s) = %d", pidColumn(pid), paint(colorName, name), fd, peer, ret), true
+}
+
+// readSockaddrUnix reads a struct sockaddr_un from the tracee, ok is false if it's another address family
+func readSockaddrUnix(pid int, addr uintptr, length int) (string, bool) {
+	if addr == 0 || length < 2 || length > syscall.SizeofSockaddrUnix {
+		return "", false
+	}
+	b, err := strace.PeekData(pid, addr, length)
+	if err != nil || len(b) < 2 {
+		return "", false
+	}
+	if binary.LittleEndian.Uint16(b) != syscall.AF_UNIX {
+		return "", false
+	}
+
+	path := b[2:]
+	if len(path) > 0 && path[0] == 0 {
+		// abstract names aren't nul terminated, their length comes from addrlen
+		return "@" + string(path[1:]), true
+	}
+	if i := strings.IndexByte(string(path), 0); i >= 0 {
+		path = path[:i]
+	}
+	return string(path), true
+}
+
+// connectedPeer asks the kernel about the other end of the tracee's socket fd,
+// by copying the fd into our process (pidfd_getfd, linux 5.6+) and using getpeername and SO_PEERCRED on it
+func connectedPeer(pid, fd int) (unixPeer, bool) {
+	local, err := strace.GetFd(pid, fd)
+	if err != nil {
+		return unixPeer{}, false
+	}
+	defer syscall.Close(local)
+
+	sa, err := syscall.Getpeername(local)
+	if err != nil {
+		return unixPeer{}, false
+	}
+	un, ok := sa.(*syscall.SockaddrUnix)
+	if !ok {
+		return unixPeer{}, false
+	}
+
+	peer := unixPeer{path: un.Name}
+	if cred, err := syscall.GetsockoptUcred(local, syscall.SOL_SOCKET, syscall.SO_PEERCRED); err == nil {
+		peer.pid = int(cred.Pid)
+	}
+	return peer, true
+}
+
+// listenerPid finds the process holding the listening unix socket bound to path,
+// by looking up the socket inode in /proc/net/unix and then searching for it in /proc/*/fd.
+// returns 0 if it can't be found (or we can't look into the owner's fds)
+func listenerPid(path string) int {
+	const acceptCon = 0x10000 // __SO_ACCEPTCON, set on listening sockets
+
+	f, err := os.Open("/proc/net/unix")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	inode := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Num RefCount Protocol Flags Type St Inode Path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[7] != path {
+			continue
+		}
+		var flags uint64
+		fmt.Sscanf(fields[3], "%x", &flags)
+		if flags&acceptCon != 0 {
+			inode = fields[6]
+			break
+		}
+	}
+	if inode == "" {
+		return 0
+	}
+
+	target := "socket:[" + inode + "]"
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err == nil && link == target {
+			var pid int
+			fmt.Sscanf(fd, "/proc/%d/", &pid)
+			return pid
+		}
+	}
+	return 0
+}
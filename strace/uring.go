@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// uringTracker decodes what programs submit through io_uring, which otherwise only shows up as a stream of
+// io_uring_enter calls. it learns the ring layout from io_uring_setup, where the rings are from the tracee's
+// mmaps of the ring fd, and reads the pending submission queue entries on every io_uring_enter, before the
+// kernel consumes them. rings polled by a kernel thread (IORING_SETUP_SQPOLL) don't need io_uring_enter to
+// submit, so their entries can't be caught
+type uringTracker struct {
+	tgids threadGroups
+	rings map[uringKey]*uringRing
+	ops   map[string]int // submitted entries by opcode, for the summary
+}
+
+// rings are by process, the fd and its mappings are shared by all its threads, so a ring one thread set up
+// is still decoded when another submits on it
+type uringKey struct {
+	tgid, fd int
+}
+
+type uringRing struct {
+	flags  uint32
+	sqOff  [7]uint32 // head, tail, ring_mask, ring_entries, flags, dropped, array
+	sqRing uint64    // where the tracee mapped the submission ring, 0 until it does
+	sqes   uint64    // and the entries
+}
+
+// uringSQE is the interesting part of a struct io_uring_sqe
+type uringSQE struct {
+	opcode   uint8
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	userData uint64
+}
+
+const (
+	uringOffSQRing = 0
+	uringOffSQEs   = 0x10000000
+
+	uringSetupSQPoll    = 1 << 1
+	uringSetupNoSQArray = 1 << 16
+
+	uringSQESize = 64
+)
+
+var uringOps = []string{
+	"NOP", "READV", "WRITEV", "FSYNC", "READ_FIXED", "WRITE_FIXED", "POLL_ADD", "POLL_REMOVE",
+	"SYNC_FILE_RANGE", "SENDMSG", "RECVMSG", "TIMEOUT", "TIMEOUT_REMOVE", "ACCEPT", "ASYNC_CANCEL",
+	"LINK_TIMEOUT", "CONNECT", "FALLOCATE", "OPENAT", "CLOSE", "FILES_UPDATE", "STATX", "READ", "WRITE",
+	"FADVISE", "MADVISE", "SEND", "RECV", "OPENAT2", "EPOLL_CTL", "SPLICE", "PROVIDE_BUFFERS",
+	"REMOVE_BUFFERS", "TEE", "SHUTDOWN", "RENAMEAT", "UNLINKAT", "MKDIRAT", "SYMLINKAT", "LINKAT",
+	"MSG_RING", "FSETXATTR", "SETXATTR", "FGETXATTR", "GETXATTR", "SOCKET", "URING_CMD", "SEND_ZC",
+	"SENDMSG_ZC", "READ_MULTISHOT", "WAITID", "FUTEX_WAIT", "FUTEX_WAKE", "FUTEX_WAITV",
+	"FIXED_FD_INSTALL", "FTRUNCATE", "BIND", "LISTEN",
+}
+
+func uringOpName(op uint8) string {
+	if int(op) < len(uringOps) {
+		return uringOps[op]
+	}
+	return fmt.Sprintf("OP_%d", op)
+}
+
+func (s uringSQE) String() string {
+	return fmt.Sprintf("%s fd=%d off=%d addr=%#x len=%d user_data=%d", uringOpName(s.opcode), s.fd, s.off, s.addr, s.len, s.userData)
+}
+
+func newUringTracker() *uringTracker {
+	return &uringTracker{tgids: threadGroups{}, rings: map[uringKey]*uringRing{}, ops: map[string]int{}}
+}
+
+// exit picks up new rings and their mappings from syscalls that just returned, given their entry args
+func (u *uringTracker) exit(pid int, name string, args [6]uint64, ret int64) {
+	if ret < 0 {
+		return
+	}
+	tgid := u.tgids.of(pid)
+	switch name {
+	case "io_uring_setup":
+		// struct io_uring_params, the kernel filled in the offsets: 10 u32s, then struct io_sqring_offsets
+		params, err := strace.PeekData(pid, uintptr(args[1]), 68)
+		if err != nil || len(params) < 68 {
+			return
+		}
+		r := &uringRing{flags: binary.LittleEndian.Uint32(params[8:])}
+		for i := range r.sqOff {
+			r.sqOff[i] = binary.LittleEndian.Uint32(params[40+4*i:])
+		}
+		u.rings[uringKey{tgid, int(ret)}] = r
+	case "mmap":
+		r, ok := u.rings[uringKey{tgid, int(int32(args[4]))}]
+		if !ok {
+			return
+		}
+		switch args[5] {
+		case uringOffSQRing:
+			r.sqRing = uint64(ret)
+		case uringOffSQEs:
+			r.sqes = uint64(ret)
+		}
+	case "close":
+		delete(u.rings, uringKey{tgid, int(int32(args[0]))})
+	}
+}
+
+// enter returns the entries an io_uring_enter is about to submit
+func (u *uringTracker) enter(pid int, name string, args [6]uint64) []uringSQE {
+	if name != "io_uring_enter" {
+		return nil
+	}
+	r, ok := u.rings[uringKey{u.tgids.of(pid), int(int32(args[0]))}]
+	if !ok || r.sqRing == 0 || r.sqes == 0 || r.flags&uringSetupSQPoll != 0 {
+		return nil
+	}
+
+	head, ok1 := peekU32(pid, r.sqRing+uint64(r.sqOff[0]))
+	tail, ok2 := peekU32(pid, r.sqRing+uint64(r.sqOff[1]))
+	mask, ok3 := peekU32(pid, r.sqRing+uint64(r.sqOff[2]))
+	if !ok1 || !ok2 || !ok3 {
+		return nil
+	}
+	pending := tail - head
+	if toSubmit := uint32(args[1]); pending > toSubmit {
+		pending = toSubmit
+	}
+
+	var sqes []uringSQE
+	for i := uint32(0); i < pending; i++ {
+		idx := (head + i) & mask
+		if r.flags&uringSetupNoSQArray == 0 {
+			if idx, ok = peekU32(pid, r.sqRing+uint64(r.sqOff[6])+4*uint64(idx)); !ok {
+				break
+			}
+		}
+		b, err := strace.PeekData(pid, uintptr(r.sqes+uringSQESize*uint64(idx)), 40)
+		if err != nil || len(b) < 40 {
+			break
+		}
+		sqe := uringSQE{
+			opcode:   b[0],
+			fd:       int32(binary.LittleEndian.Uint32(b[4:])),
+			off:      binary.LittleEndian.Uint64(b[8:]),
+			addr:     binary.LittleEndian.Uint64(b[16:]),
+			len:      binary.LittleEndian.Uint32(b[24:]),
+			userData: binary.LittleEndian.Uint64(b[32:]),
+		}
+		u.ops[uringOpName(sqe.opcode)]++
+		sqes = append(sqes, sqe)
+	}
+	return sqes
+}
+
+// print adds a row per submitted opcode to the summary, if the tracee used io_uring at all
+func (u *uringTracker) print(w io.Writer) {
+	ops := make([]string, 0, len(u.ops))
+	for op := range u.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		fmt.Fprintf(w, "io_uring:%s -> %v \n", op, u.ops[op])
+	}
+}
+
+func peekU32(pid int, addr uint64) (uint32, bool) {
+	b, err := strace.PeekData(pid, uintptr(addr), 4)
+	if err != nil || len(b) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b), true
+}
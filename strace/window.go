@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/hpdobrica/go-playground/strace/pkg/strace"
+)
+
+// runAfter starts cmd untraced and attaches to it once -start-after is up, so a noisy startup isn't in the
+// trace. children it started before that aren't traced, only the ones after with -f
+func runAfter(tracer *strace.Tracer, cmd *exec.Cmd, delay time.Duration) (*strace.Result, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	pid := cmd.Process.Pid
+	fmt.Printf(">>>not tracing %d for the first %v\n", pid, delay)
+
+	// polled and not waited for, a wait that's still running once we attach would take the tracee's stops
+	res := &strace.Result{Pid: pid}
+	for deadline := time.Now().Add(delay); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		wpid, err := syscall.Wait4(pid, &res.Status, syscall.WNOHANG, &res.Rusage)
+		if err != nil {
+			return nil, fmt.Errorf("waiting for %d: %w", pid, err)
+		}
+		if wpid == pid {
+			fmt.Printf(">>>%d exited before -start-after %v, nothing was traced\n", pid, delay)
+			cmd.Wait() // for its output to be copied
+			return res, nil
+		}
+	}
+
+	startWindow(tracer)
+	res, err := tracer.Attach(pid)
+	if err == nil && !res.Detached {
+		cmd.Wait()
+	}
+	return res, err
+}
+
+// attachAfter attaches to a running process once -start-after is up, nil if it's gone by then
+func attachAfter(tracer *strace.Tracer, pid int, delay time.Duration) (*strace.Result, error) {
+	for deadline := time.Now().Add(delay); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			return nil, fmt.Errorf("%d exited before -start-after %v", pid, delay)
+		}
+	}
+	startWindow(tracer)
+	return tracer.Attach(pid)
+}
+
+// startWindow starts the -trace-for (or -duration) timer, from when tracing starts
+func startWindow(tracer *strace.Tracer) {
+	if *maxDuration > 0 {
+		time.AfterFunc(*maxDuration, func() {
+			fmt.Printf(">>>traced for %v\n", *maxDuration)
+			tracer.Detach()
+		})
+	}
+}